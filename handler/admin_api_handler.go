@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// UserList is a page of users returned by GET /api/admin/users
+type UserList struct {
+	Users      []datauser.UserSummary `json:"users"`
+	Pagination Pagination             `json:"pagination"`
+}
+
+// MessageList is a page of the messages of a user returned by GET /api/admin/users/:id/messages
+type MessageList struct {
+	Messages   []datauser.ChatMessage `json:"messages"`
+	Pagination Pagination             `json:"pagination"`
+	Handoff    HandoffState           `json:"handoff"`
+}
+
+// parseTimeParam parses a from or to query parameter, either a day formatted as reportDateLayout or an RFC 3339 time.
+// A to day is inclusive, so it is turned into the start of the following day.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.ParseInLocation(reportDateLayout, value, time.Local); err == nil {
+		if endOfDay {
+			return day.AddDate(0, 0, 1), nil
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// timeRangeParams parses the from and to query parameters of an admin list request. Both are optional.
+func timeRangeParams(c *fiber.Ctx) (time.Time, time.Time, bool) {
+	from, err := parseTimeParam(c.Query("from"), false)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := parseTimeParam(c.Query("to"), true)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// AdminAPI registers the admin API over the users and their conversations, protected by ADMIN_TOKEN.
+// Admins can also reply to a user through the bot and pause its automatic replies while they handle the conversation.
+func AdminAPI(app *fiber.App, bot *tgbotapi.BotAPI) {
+	admin := app.Group("/api/admin", requireAdminToken)
+	admin.Get("/users", handleListUsers)
+	admin.Get("/users/:id/messages", handleListUserMessages)
+	admin.Post("/users/:id/messages", func(c *fiber.Ctx) error {
+		return handleSendAdminMessage(c, bot)
+	})
+	admin.Put("/users/:id/handoff", handleSetHandoff)
+	admin.Get("/users/:id/photo", func(c *fiber.Ctx) error {
+		return handleUserPhoto(c, bot)
+	})
+}
+
+// handleListUsers returns a page of the users, most recently seen first, e.g.
+// /api/admin/users?q=budi&from=2024-01-01&to=2024-01-31 for the users named budi last seen in January
+func handleListUsers(c *fiber.Ctx) error {
+	page, perPage, valid := pageParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page must be a positive number and per_page between 1 and " + strconv.Itoa(maxAPIPageSize)})
+	}
+	from, to, valid := timeRangeParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from and to must be dates formatted as " + reportDateLayout + " or RFC 3339 times"})
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	users := db.UserSummaries(datauser.UserFilter{From: from, To: to, Text: strings.TrimSpace(c.Query("q"))})
+	start, end, pagination := paginate(len(users), page, perPage)
+	list := UserList{Users: []datauser.UserSummary{}, Pagination: pagination}
+	list.Users = append(list.Users, users[start:end]...)
+	return c.JSON(list)
+}
+
+// handleListUserMessages returns a page of the conversations of a user, newest first, e.g.
+// /api/admin/users/42/messages?q=python&from=2024-01-01&chat=-1001234
+func handleListUserMessages(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user id must be a number"})
+	}
+	page, perPage, valid := pageParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page must be a positive number and per_page between 1 and " + strconv.Itoa(maxAPIPageSize)})
+	}
+	from, to, valid := timeRangeParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from and to must be dates formatted as " + reportDateLayout + " or RFC 3339 times"})
+	}
+	filter := datauser.MessageFilter{From: from, To: to, Text: strings.TrimSpace(c.Query("q"))}
+	if chat := c.Query("chat"); chat != "" {
+		filter.ChatID, err = strconv.ParseInt(chat, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "chat must be a chat id"})
+		}
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if _, found := db.FindUser(userID); !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+
+	messages := db.UserMessages(userID, filter)
+	start, end, pagination := paginate(len(messages), page, perPage)
+	list := MessageList{Messages: []datauser.ChatMessage{}, Pagination: pagination}
+	list.Messages = append(list.Messages, messages[start:end]...)
+	if chat, found := db.FindChat(userID); found {
+		list.Handoff = handoffState(chat, time.Now())
+	}
+	return c.JSON(list)
+}
+
+// handleUserPhoto serves the profile photo of a user, downloaded from Telegram with the bot token so the token
+// never reaches the browser
+func handleUserPhoto(c *fiber.Ctx, bot *tgbotapi.BotAPI) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user id must be a number"})
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	user, found := db.FindUser(userID)
+	if !found || user.ProfilePhotoFileID == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "profile photo not found"})
+	}
+
+	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: user.ProfilePhotoFileID})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"user_id_hash": hashID(userID),
+			"error":        err,
+		}).Error("Failed to get profile photo file")
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to get the photo from Telegram"})
+	}
+	request, err := http.NewRequest(http.MethodGet, file.Link(bot.Token), nil)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	response, err := bot.Client.Do(request)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"user_id_hash": hashID(userID),
+			"error":        err,
+		}).Error("Failed to download profile photo")
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to get the photo from Telegram"})
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to get the photo from Telegram"})
+	}
+	photo, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to get the photo from Telegram"})
+	}
+
+	// Foto hanya boleh disimpan di cache browser admin, bukan di proxy bersama
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	return c.Send(photo)
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// adminIDs returns the Telegram user IDs listed in the ADMIN_IDS environment variable (comma separated)
+func adminIDs() []int64 {
+	var ids []int64
+	for _, field := range strings.Split(os.Getenv("ADMIN_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"value": field,
+			}).Warn("Invalid admin ID in ADMIN_IDS")
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// isAdmin reports whether the Telegram user is a bot admin
+func isAdmin(userID int64) bool {
+	for _, id := range adminIDs() {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// adminSessionCookie holds the session of an admin logged in to the dashboards from a browser
+const adminSessionCookie = "admin_session"
+
+// adminSessionDuration is how long a dashboard login lasts
+const adminSessionDuration = 12 * time.Hour
+
+// adminSessionNonceSize is the number of random bytes making each session cookie unique
+const adminSessionNonceSize = 16
+
+// loggedOutSessions holds the nonces of the sessions ended with /logout until they expire anyway
+var loggedOutSessions = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+// adminSessionMAC signs the issue time and nonce of a session with ADMIN_TOKEN
+func adminSessionMAC(adminToken, issued, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(adminToken))
+	mac.Write([]byte(adminSessionCookie + "\n" + issued + "\n" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newAdminSession builds a session cookie value "<issue time>.<nonce>.<signature>". The signature uses ADMIN_TOKEN,
+// so the token itself never leaves the login form and changing it logs every browser out.
+func newAdminSession(adminToken string, now time.Time) (string, error) {
+	nonce := make([]byte, adminSessionNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	issued := strconv.FormatInt(now.Unix(), 10)
+	encodedNonce := hex.EncodeToString(nonce)
+	return issued + "." + encodedNonce + "." + adminSessionMAC(adminToken, issued, encodedNonce), nil
+}
+
+// parseAdminSession checks the signature of a session cookie value and returns its nonce and expiry time
+func parseAdminSession(session, adminToken string) (string, time.Time, bool) {
+	parts := strings.Split(session, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(adminSessionMAC(adminToken, parts[0], parts[1]))) {
+		return "", time.Time{}, false
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return parts[1], time.Unix(issued, 0).Add(adminSessionDuration), true
+}
+
+// validAdminSession reports whether a session cookie value is signed with ADMIN_TOKEN, was issued less than
+// adminSessionDuration ago and was not ended with /logout
+func validAdminSession(session, adminToken string, now time.Time) bool {
+	nonce, expires, valid := parseAdminSession(session, adminToken)
+	if !valid || !now.Before(expires) || now.Before(expires.Add(-adminSessionDuration)) {
+		return false
+	}
+
+	loggedOutSessions.Lock()
+	defer loggedOutSessions.Unlock()
+	_, loggedOut := loggedOutSessions.expires[nonce]
+	return !loggedOut
+}
+
+// endAdminSession rejects a session from now on. Ended sessions are kept in memory until they expire.
+func endAdminSession(session, adminToken string, now time.Time) {
+	nonce, expires, valid := parseAdminSession(session, adminToken)
+	if !valid {
+		return
+	}
+
+	loggedOutSessions.Lock()
+	defer loggedOutSessions.Unlock()
+	for ended, at := range loggedOutSessions.expires {
+		if !now.Before(at) {
+			delete(loggedOutSessions.expires, ended)
+		}
+	}
+	if now.Before(expires) {
+		loggedOutSessions.expires[nonce] = expires
+	}
+}
+
+// adminAuthorized reports whether the request carries ADMIN_TOKEN as "Authorization: Bearer <token>"
+// or the session cookie set by /login. The token is never accepted in the URL, where it would end up in logs and history.
+func adminAuthorized(c *fiber.Ctx, adminToken string) bool {
+	if token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+	}
+	session := c.Cookies(adminSessionCookie)
+	return session != "" && validAdminSession(session, adminToken, time.Now())
+}
+
+// requireAdminToken only lets through HTTP requests authorized by adminAuthorized.
+// Without ADMIN_TOKEN the admin routes are closed.
+func requireAdminToken(c *fiber.Ctx) error {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "ADMIN_TOKEN is not set"})
+	}
+	if !adminAuthorized(c, adminToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid admin token"})
+	}
+	return c.Next()
+}
+
+// requireAdminPage protects the dashboard pages like requireAdminToken, but sends browsers without a session to /login
+func requireAdminPage(c *fiber.Ctx) error {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "ADMIN_TOKEN is not set"})
+	}
+	if !adminAuthorized(c, adminToken) {
+		return c.Redirect("/login?next=" + url.QueryEscape(c.Path()))
+	}
+	return c.Next()
+}
+
+// loginRedirect returns where to go after logging in. Only local paths are allowed, so /login can't redirect elsewhere.
+func loginRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/dashboard"
+	}
+	return next
+}
+
+// AdminLogin registers the login form of the dashboards. A successful login sets an HttpOnly session cookie,
+// which the dashboard pages and their API calls send instead of the token.
+func AdminLogin(app *fiber.App) {
+	app.Get("/login", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(datauser.LoginPage)
+	})
+	app.Post("/login", handleLogin)
+	app.Post("/logout", func(c *fiber.Ctx) error {
+		if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+			endAdminSession(c.Cookies(adminSessionCookie), adminToken, time.Now())
+		}
+		c.ClearCookie(adminSessionCookie)
+		return c.Redirect("/login")
+	})
+}
+
+// handleLogin checks the token posted by the login form and starts a session
+func handleLogin(c *fiber.Ctx) error {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "ADMIN_TOKEN is not set"})
+	}
+
+	next := loginRedirect(c.Query("next"))
+	if subtle.ConstantTimeCompare([]byte(c.FormValue("token")), []byte(adminToken)) != 1 {
+		logrus.WithFields(logrus.Fields{
+			"ip": c.IP(),
+		}).Warn("Failed dashboard login")
+		return c.Redirect("/login?error=1&next=" + url.QueryEscape(next))
+	}
+
+	now := time.Now()
+	session, err := newAdminSession(adminToken, now)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to create dashboard session")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     adminSessionCookie,
+		Value:    session,
+		Path:     "/",
+		Expires:  now.Add(adminSessionDuration),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		// Strict juga mencegah situs lain memakai sesi untuk POST ke endpoint admin
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+	return c.Redirect(next)
+}
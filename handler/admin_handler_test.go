@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminSessionExpiry(t *testing.T) {
+	issued := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	session, err := newAdminSession("token-admin", issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		session    string
+		adminToken string
+		now        time.Time
+		want       bool
+	}{
+		{name: "fresh", session: session, adminToken: "token-admin", now: issued.Add(time.Minute), want: true},
+		{name: "before expiry", session: session, adminToken: "token-admin", now: issued.Add(adminSessionDuration - time.Second), want: true},
+		{name: "expired", session: session, adminToken: "token-admin", now: issued.Add(adminSessionDuration), want: false},
+		{name: "issued in the future", session: session, adminToken: "token-admin", now: issued.Add(-time.Minute), want: false},
+		{name: "rotated token", session: session, adminToken: "token-baru", now: issued.Add(time.Minute), want: false},
+		{name: "forged issue time", session: "9999999999" + session[len("1717228800"):], adminToken: "token-admin", now: issued.Add(time.Minute), want: false},
+		{name: "malformed", session: "abc", adminToken: "token-admin", now: issued, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := validAdminSession(test.session, test.adminToken, test.now); got != test.want {
+				t.Errorf("validAdminSession = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdminSessionsAreUniqueAndEndOnLogout(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "token-admin")
+	now := time.Now()
+	first, err := newAdminSession("token-admin", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newAdminSession("token-admin", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("two logins got the same session")
+	}
+
+	app := fiber.New()
+	AdminLogin(app)
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: adminSessionCookie, Value: first})
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if validAdminSession(first, "token-admin", time.Now()) {
+		t.Error("the session is still valid after logout")
+	}
+	if !validAdminSession(second, "token-admin", time.Now()) {
+		t.Error("logout ended another session")
+	}
+}
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// searchEventsFile is the JSON file holding the search event log
+const searchEventsFile = "search_events.json"
+
+// searchAttributionWindow is how long after a search a store link click still counts as its conversion
+const searchAttributionWindow = 30 * time.Minute
+
+// defaultReportDays is the date range of the search report when none is given
+const defaultReportDays = 30
+
+// defaultReportLimit is the number of queries listed in each top list of the search report
+const defaultReportLimit = 20
+
+// reportDateLayout is the format of the from and to parameters of the search report
+const reportDateLayout = "2006-01-02"
+
+// SearchEvent is a search made by a user, with the product they chose from the results if any
+type SearchEvent struct {
+	UserID        int64     `json:"user_id"`
+	ChatID        int64     `json:"chat_id"`
+	Query         string    `json:"query"`
+	Terms         []string  `json:"terms"`
+	Store         string    `json:"store,omitempty"`
+	Results       int       `json:"results"`
+	ChosenProduct string    `json:"chosen_product,omitempty"`
+	ChosenStore   string    `json:"chosen_store,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// QueryStat is how often a normalized query was searched and how often it led to a click
+type QueryStat struct {
+	Query      string  `json:"query"`
+	Searches   int     `json:"searches"`
+	Clicks     int     `json:"clicks"`
+	Conversion float64 `json:"conversion"`
+}
+
+// SearchReport summarizes the searches made in a date range
+type SearchReport struct {
+	From                 time.Time   `json:"from"`
+	To                   time.Time   `json:"to"`
+	Searches             int         `json:"searches"`
+	ZeroResultSearches   int         `json:"zero_result_searches"`
+	ConvertedSearches    int         `json:"converted_searches"`
+	Conversion           float64     `json:"conversion"`
+	TopQueries           []QueryStat `json:"top_queries"`
+	TopZeroResultQueries []QueryStat `json:"top_zero_result_queries"`
+}
+
+// searchEventsMu serializes read-modify-write cycles on the search events file
+var searchEventsMu sync.Mutex
+
+// loadSearchEvents loads the search event log from a JSON file
+func loadSearchEvents(filename string) ([]SearchEvent, error) {
+	var events []SearchEvent
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return events, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// saveSearchEvents saves the search event log to a JSON file
+func saveSearchEvents(filename string, events []SearchEvent) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// recordSearch appends a search to the search event log. Group chatter searched only because the group searches
+// every message is not a search the user made, so it is recorded only when it found books.
+func recordSearch(ctx *messageContext, query, store string, results int) {
+	if ctx.Implicit && results == 0 {
+		return
+	}
+	event := SearchEvent{
+		UserID:    ctx.Update.Message.From.ID,
+		ChatID:    ctx.ChatID(),
+		Query:     query,
+		Terms:     strings.Fields(normalizeText(query)),
+		Store:     store,
+		Results:   results,
+		Timestamp: time.Now(),
+	}
+
+	searchEventsMu.Lock()
+	defer searchEventsMu.Unlock()
+
+	events, err := loadSearchEvents(searchEventsFile)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load search events")
+		return
+	}
+	events = append(events, event)
+	if err := saveSearchEvents(searchEventsFile, events); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to save search events")
+	}
+}
+
+// attributeClick marks the product of a click as chosen in the last search with results of the user before it,
+// if that search is recent enough and didn't lead to a click yet
+func attributeClick(click Click) {
+	searchEventsMu.Lock()
+	defer searchEventsMu.Unlock()
+
+	events, err := loadSearchEvents(searchEventsFile)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load search events")
+		return
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := &events[i]
+		// Pencarian tanpa hasil tidak punya link untuk diklik
+		if event.UserID != click.UserID || event.Timestamp.After(click.Timestamp) || event.Results == 0 {
+			continue
+		}
+		if click.Timestamp.Sub(event.Timestamp) > searchAttributionWindow || event.ChosenProduct != "" {
+			return
+		}
+		event.ChosenProduct = click.Product
+		event.ChosenStore = click.Store
+		if err := saveSearchEvents(searchEventsFile, events); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to save search events")
+		}
+		return
+	}
+}
+
+// searchReport computes the search report of the events made between from and to
+func searchReport(events []SearchEvent, from, to time.Time, limit int) SearchReport {
+	report := SearchReport{From: from, To: to}
+	stats := make(map[string]*QueryStat)
+	zeroStats := make(map[string]*QueryStat)
+
+	for _, event := range events {
+		if event.Timestamp.Before(from) || !event.Timestamp.Before(to) {
+			continue
+		}
+		query := strings.Join(event.Terms, " ")
+		if query == "" {
+			continue
+		}
+
+		report.Searches++
+		stat, found := stats[query]
+		if !found {
+			stat = &QueryStat{Query: query}
+			stats[query] = stat
+		}
+		stat.Searches++
+		if event.ChosenProduct != "" {
+			report.ConvertedSearches++
+			stat.Clicks++
+		}
+
+		if event.Results == 0 {
+			report.ZeroResultSearches++
+			zeroStat, found := zeroStats[query]
+			if !found {
+				zeroStat = &QueryStat{Query: query}
+				zeroStats[query] = zeroStat
+			}
+			zeroStat.Searches++
+		}
+	}
+
+	report.Conversion = ratio(report.ConvertedSearches, report.Searches)
+	report.TopQueries = topQueries(stats, limit)
+	report.TopZeroResultQueries = topQueries(zeroStats, limit)
+	return report
+}
+
+// topQueries sorts query stats by number of searches and keeps the first limit
+func topQueries(stats map[string]*QueryStat, limit int) []QueryStat {
+	top := []QueryStat{}
+	for _, stat := range stats {
+		stat.Conversion = ratio(stat.Clicks, stat.Searches)
+		top = append(top, *stat)
+	}
+	sort.Slice(top, func(a, b int) bool {
+		if top[a].Searches != top[b].Searches {
+			return top[a].Searches > top[b].Searches
+		}
+		return top[a].Query < top[b].Query
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
+
+// ratio returns part/total, or 0 when total is 0
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// reportRange parses the from and to dates of a report request. Both are inclusive days;
+// without them the report covers the last defaultReportDays days.
+func reportRange(fromParam, toParam string) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	if toParam != "" {
+		day, err := time.ParseInLocation(reportDateLayout, toParam, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(0, 0, -defaultReportDays)
+	if fromParam != "" {
+		day, err := time.ParseInLocation(reportDateLayout, fromParam, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = day
+	}
+	return from, to, nil
+}
+
+// Analytics registers the admin analytics routes
+func Analytics(app *fiber.App) {
+	app.Get("/analytics/search", requireAdminToken, handleSearchReport)
+}
+
+// handleSearchReport returns the search report of a date range as JSON,
+// e.g. /analytics/search?from=2024-01-01&to=2024-01-31&limit=10
+func handleSearchReport(c *fiber.Ctx) error {
+	from, to, err := reportRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from and to must be dates formatted as " + reportDateLayout})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultReportLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultReportLimit
+	}
+
+	searchEventsMu.Lock()
+	events, err := loadSearchEvents(searchEventsFile)
+	searchEventsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load search events")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(searchReport(events, from, to, limit))
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	_ "embed"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+	"github.com/sirupsen/logrus"
+)
+
+// Page sizes of the list endpoints of the catalog API
+const (
+	defaultAPIPageSize = 20
+	maxAPIPageSize     = 100
+)
+
+// openAPISpec documents the catalog API, served at /api/openapi.json
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// APIProduct is a catalog product as returned by the catalog API
+type APIProduct struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Category   string      `json:"category,omitempty"`
+	Links      []StoreLink `json:"links"`
+	ReviewLink string      `json:"review_link,omitempty"`
+	Rating     *APIRating  `json:"rating,omitempty"`
+}
+
+// APIRating is the aggregated rating of a product from the approved reviews
+type APIRating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// APIReview is an approved user review as returned by the catalog API. The reviewer is never exposed.
+type APIReview struct {
+	ID        int64     `json:"id"`
+	ProductID string    `json:"product_id"`
+	Product   string    `json:"product"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pagination describes the page of a list returned by the catalog API
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// ProductList is a page of products returned by GET /api/products
+type ProductList struct {
+	Products   []APIProduct `json:"products"`
+	Pagination Pagination   `json:"pagination"`
+}
+
+// ReviewList is a page of reviews returned by GET /api/reviews
+type ReviewList struct {
+	Reviews    []APIReview `json:"reviews"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// productID returns the stable identifier of a product in the catalog API, the normalized title joined by dashes.
+// Titles are compared the same way by the admin catalog commands, so two products never share an ID.
+func productID(name string) string {
+	return strings.ReplaceAll(normalizeText(name), " ", "-")
+}
+
+// findProductByID returns the catalog product with the given API identifier
+func findProductByID(products []Product, id string) (*Product, bool) {
+	for i := range products {
+		if productID(products[i].Nama) == id {
+			return &products[i], true
+		}
+	}
+	return nil, false
+}
+
+// apiProduct converts a catalog product for the API, with its links in the order shown by the bot
+func apiProduct(product *Product, ratings map[string]productRating, view storeView) APIProduct {
+	result := APIProduct{
+		ID:         productID(product.Nama),
+		Name:       product.Nama,
+		Category:   product.Category,
+		Links:      productLinks(product, view),
+		ReviewLink: product.ReviewLink,
+	}
+	if result.Links == nil {
+		result.Links = []StoreLink{}
+	}
+	if rating, found := ratings[product.Nama]; found {
+		result.Rating = &APIRating{Average: rating.Average, Count: rating.Count}
+	}
+	return result
+}
+
+// pageParams parses the page and per_page query parameters of a list request
+func pageParams(c *fiber.Ctx) (int, int, bool) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, false
+	}
+	perPage, err := strconv.Atoi(c.Query("per_page", strconv.Itoa(defaultAPIPageSize)))
+	if err != nil || perPage < 1 || perPage > maxAPIPageSize {
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// paginate returns the bounds of the requested page within total items and describes the page
+func paginate(total, page, perPage int) (int, int, Pagination) {
+	pagination := Pagination{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: (total + perPage - 1) / perPage,
+	}
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	return start, end, pagination
+}
+
+// apiAllowedOrigins returns the origins allowed to call the catalog API from a browser, set in the
+// API_ALLOWED_ORIGINS environment variable (comma separated). Every origin is allowed by default.
+func apiAllowedOrigins() string {
+	origins := strings.TrimSpace(os.Getenv("API_ALLOWED_ORIGINS"))
+	if origins == "" {
+		return "*"
+	}
+	return origins
+}
+
+// API registers the public read-only catalog API. Responses carry an ETag, so clients can revalidate
+// them with If-None-Match and get 304 Not Modified while the catalog and reviews are unchanged.
+// CORS and ETag are attached to these routes only, the admin API under /api/admin gets neither.
+func API(app *fiber.App, catalog *Catalog) {
+	corsHandler := cors.New(cors.Config{
+		AllowOrigins: apiAllowedOrigins(),
+		AllowMethods: "GET,HEAD",
+	})
+	etagHandler := etag.New()
+	api := app.Group("/api")
+	public := func(path string, handler fiber.Handler) {
+		// Preflight dibutuhkan karena If-None-Match bukan header yang diizinkan CORS secara bawaan
+		api.Options(path, corsHandler)
+		api.Get(path, corsHandler, etagHandler, handler)
+	}
+
+	public("/openapi.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(openAPISpec)
+	})
+	public("/products", func(c *fiber.Ctx) error {
+		return handleListProducts(c, catalog.Products())
+	})
+	public("/products/:id", func(c *fiber.Ctx) error {
+		return handleGetProduct(c, catalog.Products())
+	})
+	public("/reviews", func(c *fiber.Ctx) error {
+		return handleListReviews(c, catalog.Products())
+	})
+}
+
+// handleListProducts returns a page of the catalog, e.g. /api/products?q=python&store=gramedia&page=2.
+// With q, products are searched like in the bot and sorted by relevance; without it they keep the catalog order.
+func handleListProducts(c *fiber.Ctx, products []Product) error {
+	page, perPage, valid := pageParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page must be a positive number and per_page between 1 and " + strconv.Itoa(maxAPIPageSize)})
+	}
+
+	var matchingProducts []*Product
+	if query := strings.TrimSpace(c.Query("q")); query != "" {
+		matchingProducts = timedFindProducts(products, query)
+	} else {
+		for i := range products {
+			matchingProducts = append(matchingProducts, &products[i])
+		}
+	}
+
+	var view storeView
+	if storeName := strings.TrimSpace(c.Query("store")); storeName != "" {
+		store, found := findStore(products, storeName)
+		if !found {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "unknown store " + storeName,
+				"stores": productStores(products),
+			})
+		}
+		view.Only = store
+		matchingProducts = filterByStore(matchingProducts, store)
+	}
+
+	start, end, pagination := paginate(len(matchingProducts), page, perPage)
+	ratings := loadProductRatings()
+	list := ProductList{Products: []APIProduct{}, Pagination: pagination}
+	for _, product := range matchingProducts[start:end] {
+		list.Products = append(list.Products, apiProduct(product, ratings, view))
+	}
+	return c.JSON(list)
+}
+
+// handleGetProduct returns one product by its API identifier
+func handleGetProduct(c *fiber.Ctx, products []Product) error {
+	product, found := findProductByID(products, c.Params("id"))
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "product not found"})
+	}
+	return c.JSON(apiProduct(product, loadProductRatings(), storeView{}))
+}
+
+// handleListReviews returns a page of the approved user reviews, newest first,
+// optionally limited to one product, e.g. /api/reviews?product=belajar-golang
+func handleListReviews(c *fiber.Ctx, products []Product) error {
+	page, perPage, valid := pageParams(c)
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page must be a positive number and per_page between 1 and " + strconv.Itoa(maxAPIPageSize)})
+	}
+	id := c.Query("product")
+	if id != "" {
+		if _, found := findProductByID(products, id); !found {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "product not found"})
+		}
+	}
+
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	userReviewsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user reviews")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	var approved []APIReview
+	for _, review := range reviews {
+		if review.Status != ReviewApproved {
+			continue
+		}
+		reviewProductID := productID(review.ProductName)
+		if id != "" && reviewProductID != id {
+			continue
+		}
+		approved = append(approved, APIReview{
+			ID:        review.ID,
+			ProductID: reviewProductID,
+			Product:   review.ProductName,
+			Rating:    review.Rating,
+			Text:      review.Text,
+			CreatedAt: review.CreatedAt,
+		})
+	}
+	sort.SliceStable(approved, func(a, b int) bool {
+		return approved[a].ID > approved[b].ID
+	})
+
+	start, end, pagination := paginate(len(approved), page, perPage)
+	list := ReviewList{Reviews: []APIReview{}, Pagination: pagination}
+	list.Reviews = append(list.Reviews, approved[start:end]...)
+	return c.JSON(list)
+}
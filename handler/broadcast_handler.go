@@ -0,0 +1,987 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const broadcastsFile = "broadcasts.json"
+
+// broadcastOptOutsFile holds the salted ID hashes of the users who opted out of broadcasts and then erased their
+// data with /hapusdata, so they stay opted out when they come back
+const broadcastOptOutsFile = "broadcast_optouts.json"
+
+// defaultBroadcastRate is the number of broadcast messages sent per second, below the Telegram limit of 30
+const defaultBroadcastRate = 20
+
+// broadcastHistoryBatch is the number of delivered broadcast messages added to the conversation history at once
+const broadcastHistoryBatch = 50
+
+// broadcastProgressBatch is the number of delivery statuses written to the broadcasts file at once. Every status is
+// also appended to the progress log of the file as soon as it is known.
+const broadcastProgressBatch = 50
+
+// broadcastSaveRetry is how long the worker waits before saving the progress of a broadcast again after a failure
+const broadcastSaveRetry = 10 * time.Second
+
+// activeSegmentWindow is how recently a user must have written to the bot to be in the "aktif" segment
+const activeSegmentWindow = 30 * 24 * time.Hour
+
+// segmentPrefix introduces the segment of a broadcast, e.g. /broadcast segmen:en Hello
+const segmentPrefix = "segmen:"
+
+// Segments of users a broadcast can be sent to, besides a language code
+const (
+	SegmentAll    = "semua"
+	SegmentActive = "aktif"
+)
+
+// Statuses of a broadcast
+const (
+	BroadcastDraft     = "draft"
+	BroadcastSending   = "sending"
+	BroadcastDone      = "done"
+	BroadcastCancelled = "cancelled"
+)
+
+// Delivery statuses of a broadcast recipient
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryBlocked   = "blocked"
+)
+
+// Broadcast is an announcement sent by an admin to a segment of users
+type Broadcast struct {
+	ID         int64                `json:"id"`
+	Text       string               `json:"text"`
+	Segment    string               `json:"segment"`
+	Status     string               `json:"status"`
+	CreatedBy  int64                `json:"created_by,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  time.Time            `json:"started_at,omitempty"`
+	FinishedAt time.Time            `json:"finished_at,omitempty"`
+	Recipients []BroadcastRecipient `json:"recipients"`
+}
+
+// BroadcastRecipient is the delivery of a broadcast to one user
+type BroadcastRecipient struct {
+	UserID int64     `json:"user_id"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	SentAt time.Time `json:"sent_at,omitempty"`
+}
+
+// BroadcastStats counts the recipients of a broadcast per delivery status
+type BroadcastStats struct {
+	Pending   int `json:"pending"`
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+	Blocked   int `json:"blocked"`
+}
+
+// Stats counts the recipients of the broadcast per delivery status
+func (b *Broadcast) Stats() BroadcastStats {
+	var stats BroadcastStats
+	for _, recipient := range b.Recipients {
+		switch recipient.Status {
+		case DeliveryPending:
+			stats.Pending++
+		case DeliveryDelivered:
+			stats.Delivered++
+		case DeliveryFailed:
+			stats.Failed++
+		case DeliveryBlocked:
+			stats.Blocked++
+		}
+	}
+	return stats
+}
+
+// broadcastJob is a broadcast being sent with its pending recipients and the language each one reads
+type broadcastJob struct {
+	ID         int64
+	Text       string
+	Recipients []int64
+	Languages  map[int64]string
+}
+
+// broadcastsMu serializes read-modify-write cycles on the broadcasts file
+var broadcastsMu sync.Mutex
+
+// broadcastOptOutsMu serializes read-modify-write cycles on the broadcast opt-outs file
+var broadcastOptOutsMu sync.Mutex
+
+// broadcastWake tells the broadcast worker that a broadcast was queued
+var broadcastWake = make(chan struct{}, 1)
+
+// cancelledBroadcasts holds the IDs of the broadcasts cancelled while being sent, so the worker stops before
+// its next message
+var cancelledBroadcasts = struct {
+	sync.Mutex
+	ids map[int64]bool
+}{ids: make(map[int64]bool)}
+
+// broadcastProgress is a line of the progress log: the delivery status of one recipient of a broadcast
+type broadcastProgress struct {
+	BroadcastID int64 `json:"broadcast_id"`
+	BroadcastRecipient
+}
+
+// broadcastProgressFile returns the progress log of a broadcasts file, which holds the delivery statuses not yet
+// written to the file itself
+func broadcastProgressFile(filename string) string {
+	return strings.TrimSuffix(filename, ".json") + "_progress.jsonl"
+}
+
+// loadBroadcasts loads all broadcasts from a JSON file, with the delivery statuses of its progress log applied
+func loadBroadcasts(filename string) ([]Broadcast, error) {
+	var broadcasts []Broadcast
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return broadcasts, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &broadcasts)
+	if err != nil {
+		return nil, err
+	}
+	return broadcasts, applyBroadcastProgress(broadcastProgressFile(filename), broadcasts)
+}
+
+// applyBroadcastProgress sets the delivery statuses of the progress log on the pending recipients.
+// A line cut short by a crash is ignored: its recipient stays pending.
+func applyBroadcastProgress(filename string, broadcasts []Broadcast) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	index := make(map[int64]*Broadcast, len(broadcasts))
+	for i := range broadcasts {
+		index[broadcasts[i].ID] = &broadcasts[i]
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		var progress broadcastProgress
+		if strings.TrimSpace(line) == "" || json.Unmarshal([]byte(line), &progress) != nil {
+			continue
+		}
+		broadcast, found := index[progress.BroadcastID]
+		if !found {
+			continue
+		}
+		for i := range broadcast.Recipients {
+			recipient := &broadcast.Recipients[i]
+			if recipient.UserID == progress.UserID && recipient.Status == DeliveryPending {
+				*recipient = progress.BroadcastRecipient
+			}
+		}
+	}
+	return nil
+}
+
+// saveBroadcasts saves all broadcasts to a JSON file. The broadcasts were loaded with their progress log applied,
+// so the log is removed once the file is written.
+func saveBroadcasts(filename string, broadcasts []Broadcast) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(broadcasts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(broadcastProgressFile(filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// appendBroadcastProgress adds the delivery status of a recipient to the progress log of the broadcasts file,
+// so a restart doesn't message the recipient again even before the status is written to the file
+func appendBroadcastProgress(id int64, result BroadcastRecipient) error {
+	data, err := json.Marshal(broadcastProgress{BroadcastID: id, BroadcastRecipient: result})
+	if err != nil {
+		return err
+	}
+
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+	file, err := os.OpenFile(broadcastProgressFile(broadcastsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// broadcastCancelled reports whether a broadcast was cancelled while being sent
+func broadcastCancelled(id int64) bool {
+	cancelledBroadcasts.Lock()
+	defer cancelledBroadcasts.Unlock()
+	return cancelledBroadcasts.ids[id]
+}
+
+// updateBroadcast applies fn to a broadcast and saves it. It returns the updated broadcast,
+// and false if the broadcast doesn't exist.
+func updateBroadcast(id int64, fn func(broadcast *Broadcast) error) (Broadcast, bool, error) {
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err != nil {
+		return Broadcast{}, false, err
+	}
+	for i := range broadcasts {
+		if broadcasts[i].ID != id {
+			continue
+		}
+		if err := fn(&broadcasts[i]); err != nil {
+			return broadcasts[i], true, err
+		}
+		return broadcasts[i], true, saveBroadcasts(broadcastsFile, broadcasts)
+	}
+	return Broadcast{}, false, nil
+}
+
+// loadBroadcastOptOuts loads the opt-out hashes from a JSON file
+func loadBroadcastOptOuts(filename string) ([]string, error) {
+	var optOuts []string
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return optOuts, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &optOuts)
+	if err != nil {
+		return nil, err
+	}
+	return optOuts, nil
+}
+
+// saveBroadcastOptOuts saves the opt-out hashes to a JSON file
+func saveBroadcastOptOuts(filename string, optOuts []string) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(optOuts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// setBroadcastOptOut adds the hash of a user to the opt-out list, or removes it
+func setBroadcastOptOut(userID int64, optedOut bool) error {
+	broadcastOptOutsMu.Lock()
+	defer broadcastOptOutsMu.Unlock()
+
+	optOuts, err := loadBroadcastOptOuts(broadcastOptOutsFile)
+	if err != nil {
+		return err
+	}
+	hash := saltedHash(userID)
+	kept := optOuts[:0]
+	for _, optOut := range optOuts {
+		if optOut != hash {
+			kept = append(kept, optOut)
+		}
+	}
+	if optedOut {
+		kept = append(kept, hash)
+	} else if len(kept) == len(optOuts) {
+		return nil
+	}
+	return saveBroadcastOptOuts(broadcastOptOutsFile, kept)
+}
+
+// normalizeSegment maps a segment name or alias to a segment, and returns false for unknown segments
+func normalizeSegment(segment string) (string, bool) {
+	segment = strings.ToLower(strings.TrimSpace(segment))
+	switch segment {
+	case "", SegmentAll, "all":
+		return SegmentAll, true
+	case SegmentActive, "active":
+		return SegmentActive, true
+	}
+	if lang := normalizeLanguage(segment); lang != "" {
+		return lang, true
+	}
+	return "", false
+}
+
+// parseBroadcast splits the arguments of /broadcast into the segment and the text, keeping the line breaks of the text
+func parseBroadcast(args string) (string, string) {
+	args = strings.TrimSpace(args)
+	if !strings.HasPrefix(strings.ToLower(args), segmentPrefix) {
+		return "", args
+	}
+	end := strings.IndexAny(args, " \n\t")
+	if end < 0 {
+		return args[len(segmentPrefix):], ""
+	}
+	return args[len(segmentPrefix):end], strings.TrimSpace(args[end:])
+}
+
+// broadcastRecipients returns the users of a segment who can receive broadcasts: those with a private chat
+// with the bot who didn't opt out with /berhenti
+func broadcastRecipients(segment string, now time.Time) ([]int64, error) {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	broadcastOptOutsMu.Lock()
+	optOutList, err := loadBroadcastOptOuts(broadcastOptOutsFile)
+	broadcastOptOutsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	optOuts := make(map[string]bool, len(optOutList))
+	for _, hash := range optOutList {
+		optOuts[hash] = true
+	}
+
+	var recipients []int64
+	for i := range db.Users {
+		user := &db.Users[i]
+		chat, found := db.FindChat(user.ID)
+		if user.Unsubscribed || !found || chat.Type != datauser.ChatPrivate {
+			continue
+		}
+		if len(optOuts) > 0 && optOuts[saltedHash(user.ID)] {
+			continue
+		}
+		switch segment {
+		case SegmentAll:
+		case SegmentActive:
+			if now.Sub(chat.Stats().LastMessageAt) > activeSegmentWindow {
+				continue
+			}
+		default:
+			if recipientLanguage(user, chat) != segment {
+				continue
+			}
+		}
+		recipients = append(recipients, user.ID)
+	}
+	return recipients, nil
+}
+
+// recipientLanguage returns the language a user reads broadcasts in
+func recipientLanguage(user *datauser.UserData, chat *datauser.ChatData) string {
+	if user.Language != "" {
+		return user.Language
+	}
+	if chat != nil && chat.Language != "" {
+		return chat.Language
+	}
+	return detectLanguage(user.LanguageCode)
+}
+
+// broadcastText is the message a recipient receives: the broadcast followed by how to opt out
+func broadcastText(text, lang string) string {
+	return text + "\n\n" + tr(lang, "broadcast_footer")
+}
+
+// createBroadcast stores a new draft broadcast, sent once queued with queueBroadcast
+func createBroadcast(text, segment string, createdBy int64) (Broadcast, error) {
+	broadcast := Broadcast{
+		ID:         1,
+		Text:       text,
+		Segment:    segment,
+		Status:     BroadcastDraft,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now(),
+		Recipients: []BroadcastRecipient{},
+	}
+
+	broadcastsMu.Lock()
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err == nil {
+		if len(broadcasts) > 0 {
+			broadcast.ID = broadcasts[len(broadcasts)-1].ID + 1
+		}
+		err = saveBroadcasts(broadcastsFile, append(broadcasts, broadcast))
+	}
+	broadcastsMu.Unlock()
+	return broadcast, err
+}
+
+// queueBroadcast picks the recipients of a draft broadcast and hands it to the worker. The recipients are
+// picked now rather than when the draft was made, so users who opted out meanwhile are left out.
+func queueBroadcast(id int64) (Broadcast, error) {
+	broadcast, found, err := updateBroadcast(id, func(broadcast *Broadcast) error {
+		if broadcast.Status != BroadcastDraft {
+			return fmt.Errorf("broadcast is %s", broadcast.Status)
+		}
+		recipients, err := broadcastRecipients(broadcast.Segment, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, userID := range recipients {
+			broadcast.Recipients = append(broadcast.Recipients, BroadcastRecipient{UserID: userID, Status: DeliveryPending})
+		}
+		broadcast.Status = BroadcastSending
+		broadcast.StartedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return broadcast, err
+	}
+	if !found {
+		return broadcast, fmt.Errorf("broadcast %d not found", id)
+	}
+	wakeBroadcasts()
+	return broadcast, nil
+}
+
+// cancelBroadcast stops a draft or a broadcast being sent. Recipients already reached keep their status.
+func cancelBroadcast(id int64) (Broadcast, bool, error) {
+	broadcast, found, err := updateBroadcast(id, func(broadcast *Broadcast) error {
+		if broadcast.Status != BroadcastDraft && broadcast.Status != BroadcastSending {
+			return fmt.Errorf("broadcast is %s", broadcast.Status)
+		}
+		broadcast.Status = BroadcastCancelled
+		broadcast.FinishedAt = time.Now()
+		return nil
+	})
+	if err == nil && found {
+		cancelledBroadcasts.Lock()
+		cancelledBroadcasts.ids[id] = true
+		cancelledBroadcasts.Unlock()
+	}
+	return broadcast, found, err
+}
+
+// wakeBroadcasts tells the worker there may be messages to send
+func wakeBroadcasts() {
+	select {
+	case broadcastWake <- struct{}{}:
+	default:
+	}
+}
+
+// broadcastRate returns the number of broadcast messages sent per second, set with BROADCAST_RATE
+func broadcastRate() int {
+	rate := envInt("BROADCAST_RATE", defaultBroadcastRate)
+	if rate <= 0 {
+		return defaultBroadcastRate
+	}
+	return rate
+}
+
+// StartBroadcasts starts the worker that sends queued broadcasts. Broadcasts interrupted by a restart
+// resume with their pending recipients.
+func StartBroadcasts(bot *tgbotapi.BotAPI) {
+	rate := broadcastRate()
+	logrus.WithFields(logrus.Fields{
+		"rate_per_second": rate,
+	}).Info("Starting broadcast worker")
+
+	go runBroadcasts(bot, time.Second/time.Duration(rate))
+	wakeBroadcasts()
+}
+
+// runBroadcasts sends the pending messages of the broadcasts being sent, one every interval
+func runBroadcasts(bot *tgbotapi.BotAPI, interval time.Duration) {
+	out := newSender(bot, 0)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, found := nextBroadcastJob()
+		if !found {
+			// Antrean kosong: simpan riwayat yang tersisa lalu tunggu broadcast berikutnya
+			saveBotMessages(out.sent)
+			out.sent = nil
+			<-broadcastWake
+			continue
+		}
+		sendBroadcast(out, job, ticker)
+	}
+}
+
+// sendBroadcast delivers a broadcast to its pending recipients. Each delivery status is appended to the progress
+// log right away, and written to the broadcasts file every broadcastProgressBatch deliveries. A cancellation stops
+// the worker before its next message.
+func sendBroadcast(out *sender, job broadcastJob, ticker *time.Ticker) {
+	var results []BroadcastRecipient
+	for i := 0; i < len(job.Recipients); {
+		userID := job.Recipients[i]
+		<-ticker.C
+		if broadcastCancelled(job.ID) {
+			saveBroadcastProgress(job.ID, results)
+			logrus.WithFields(logrus.Fields{
+				"broadcast_id": job.ID,
+			}).Info("Broadcast stopped")
+			return
+		}
+		status, errText, retryAfter := deliverBroadcast(out, job.Text, userID, job.Languages[userID])
+		if retryAfter > 0 {
+			time.Sleep(retryAfter)
+			continue
+		}
+		result := BroadcastRecipient{UserID: userID, Status: status, Error: errText, SentAt: time.Now()}
+		results = append(results, result)
+		i++
+		if err := appendBroadcastProgress(job.ID, result); err != nil {
+			// Status tetap disimpan bersama kelompoknya di broadcasts.json
+			logrus.WithFields(logrus.Fields{
+				"broadcast_id": job.ID,
+				"error":        err,
+			}).Error("Failed to log broadcast progress")
+		}
+
+		if len(out.sent) >= broadcastHistoryBatch {
+			saveBotMessages(out.sent)
+			out.sent = nil
+		}
+		if len(results) < broadcastProgressBatch && i < len(job.Recipients) {
+			continue
+		}
+		sending := saveBroadcastProgress(job.ID, results)
+		results = nil
+		if !sending {
+			logrus.WithFields(logrus.Fields{
+				"broadcast_id": job.ID,
+			}).Info("Broadcast stopped")
+			return
+		}
+	}
+}
+
+// nextBroadcastJob returns the first broadcast being sent that still has pending recipients, with the language
+// of each recipient. Broadcasts without pending recipients are marked as done.
+func nextBroadcastJob() (broadcastJob, bool) {
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load broadcasts")
+		return broadcastJob{}, false
+	}
+
+	var job broadcastJob
+	finished := false
+	for i := range broadcasts {
+		broadcast := &broadcasts[i]
+		if broadcast.Status != BroadcastSending {
+			continue
+		}
+		for _, recipient := range broadcast.Recipients {
+			if recipient.Status == DeliveryPending {
+				job.Recipients = append(job.Recipients, recipient.UserID)
+			}
+		}
+		if len(job.Recipients) > 0 {
+			job.ID, job.Text = broadcast.ID, broadcast.Text
+			break
+		}
+		broadcast.Status = BroadcastDone
+		broadcast.FinishedAt = time.Now()
+		finished = true
+		logrus.WithFields(logrus.Fields{
+			"broadcast_id": broadcast.ID,
+			"recipients":   len(broadcast.Recipients),
+		}).Info("Broadcast finished")
+	}
+
+	if finished {
+		if err := saveBroadcasts(broadcastsFile, broadcasts); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to save broadcasts")
+		}
+	}
+	if len(job.Recipients) == 0 {
+		return broadcastJob{}, false
+	}
+	job.Languages = recipientLanguages(job.Recipients)
+	return job, true
+}
+
+// recipientLanguages returns the language each recipient reads broadcasts in, loading the user data once
+func recipientLanguages(userIDs []int64) map[int64]string {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+	}
+
+	languages := make(map[int64]string, len(userIDs))
+	for _, userID := range userIDs {
+		languages[userID] = defaultLanguage
+	}
+	if db == nil {
+		return languages
+	}
+
+	// Indeks chat per ID agar tidak mencari ulang di seluruh daftar untuk setiap penerima
+	chats := make(map[int64]*datauser.ChatData, len(db.Chats))
+	for i := range db.Chats {
+		chats[db.Chats[i].ID] = &db.Chats[i]
+	}
+	for i := range db.Users {
+		user := &db.Users[i]
+		if _, recipient := languages[user.ID]; recipient {
+			languages[user.ID] = recipientLanguage(user, chats[user.ID])
+		}
+	}
+	return languages
+}
+
+// deliverBroadcast sends a broadcast to a user and returns the delivery status. When Telegram asks
+// to slow down it returns how long to wait instead, and the user stays pending.
+func deliverBroadcast(out *sender, text string, userID int64, lang string) (string, string, time.Duration) {
+	_, err := out.sendAbout(tgbotapi.NewMessage(userID, broadcastText(text, lang)), userID)
+	if err == nil {
+		return DeliveryDelivered, "", 0
+	}
+	if apiErr, ok := err.(*tgbotapi.Error); ok {
+		switch {
+		case apiErr.RetryAfter > 0:
+			return DeliveryPending, "", time.Duration(apiErr.RetryAfter) * time.Second
+		case apiErr.Code == 403:
+			// Pengguna memblokir bot atau menonaktifkan akunnya
+			return DeliveryBlocked, apiErr.Message, 0
+		}
+	}
+	return DeliveryFailed, redactSecrets(err.Error()), 0
+}
+
+// saveBroadcastProgress stores the delivery status of a batch of recipients and reports whether the broadcast is
+// still being sent. A failed save is retried until it succeeds: the recipients would otherwise stay pending in
+// the file and be messaged again.
+func saveBroadcastProgress(id int64, results []BroadcastRecipient) bool {
+	for {
+		broadcast, found, err := updateBroadcast(id, func(broadcast *Broadcast) error {
+			delivered := make(map[int64]BroadcastRecipient, len(results))
+			for _, result := range results {
+				delivered[result.UserID] = result
+			}
+			for i := range broadcast.Recipients {
+				recipient := &broadcast.Recipients[i]
+				if result, ok := delivered[recipient.UserID]; ok && recipient.Status == DeliveryPending {
+					*recipient = result
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			return found && broadcast.Status == BroadcastSending
+		}
+		logrus.WithFields(logrus.Fields{
+			"broadcast_id": id,
+			"error":        err,
+		}).Error("Failed to save broadcast progress, retrying")
+		time.Sleep(broadcastSaveRetry)
+	}
+}
+
+// broadcastKeyboard offers to send or cancel a draft broadcast
+func broadcastKeyboard(id int64, lang string) tgbotapi.InlineKeyboardMarkup {
+	data := strconv.FormatInt(id, 10)
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "broadcast_send"), callbackBroadcast+"send:"+data),
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "broadcast_cancel"), callbackBroadcast+"cancel:"+data),
+	))
+}
+
+// broadcastStatusText describes the progress of a broadcast
+func broadcastStatusText(broadcast Broadcast, lang string) string {
+	stats := broadcast.Stats()
+	return tr(lang, "broadcast_status", broadcast.ID, tr(lang, "broadcast_"+broadcast.Status), broadcast.Segment,
+		len(broadcast.Recipients), stats.Delivered, stats.Failed, stats.Blocked, stats.Pending)
+}
+
+// handleBroadcast previews a broadcast on /broadcast, or lists the latest broadcasts without arguments
+func handleBroadcast(ctx *messageContext) {
+	if ctx.Group != nil {
+		ctx.reply(tr(ctx.Lang, "private_only"))
+		return
+	}
+
+	segmentName, text := parseBroadcast(ctx.Args)
+	if text == "" {
+		handleBroadcastList(ctx)
+		return
+	}
+	segment, ok := normalizeSegment(segmentName)
+	if !ok {
+		ctx.reply(tr(ctx.Lang, "broadcast_bad_segment", segmentName))
+		return
+	}
+
+	recipients, err := broadcastRecipients(segment, time.Now())
+	if err != nil {
+		log.Println("Gagal memuat data pengguna:", err)
+		ctx.reply(tr(ctx.Lang, "broadcast_failed"))
+		return
+	}
+	if len(recipients) == 0 {
+		ctx.reply(tr(ctx.Lang, "broadcast_no_recipients", segment))
+		return
+	}
+
+	broadcast, err := createBroadcast(text, segment, ctx.Update.Message.From.ID)
+	if err != nil {
+		log.Println("Gagal menyimpan broadcast:", err)
+		ctx.reply(tr(ctx.Lang, "broadcast_failed"))
+		return
+	}
+	ctx.reply(tr(ctx.Lang, "broadcast_preview", segment, len(recipients)) + "\n\n" + broadcastText(text, ctx.Lang))
+	ctx.Msg.ReplyMarkup = broadcastKeyboard(broadcast.ID, ctx.Lang)
+}
+
+// handleBroadcastList shows the usage of /broadcast and the status of the latest broadcasts
+func handleBroadcastList(ctx *messageContext) {
+	broadcastsMu.Lock()
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	broadcastsMu.Unlock()
+	if err != nil {
+		log.Println("Gagal memuat broadcast:", err)
+	}
+
+	lines := []string{tr(ctx.Lang, "broadcast_usage")}
+	shown := 0
+	for i := len(broadcasts) - 1; i >= 0 && shown < 5; i-- {
+		if broadcasts[i].Status == BroadcastDraft {
+			continue
+		}
+		lines = append(lines, broadcastStatusText(broadcasts[i], ctx.Lang))
+		shown++
+	}
+	ctx.reply(strings.Join(lines, "\n\n"))
+}
+
+// handleBroadcastCallback sends or cancels a broadcast from the preview buttons
+func handleBroadcastCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, lang string, msg *tgbotapi.MessageConfig) {
+	if !isAdmin(query.From.ID) {
+		msg.Text = tr(lang, "admin_only")
+		return
+	}
+
+	parts := strings.SplitN(data, ":", 2)
+	id, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if len(parts) != 2 || err != nil {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid broadcast callback data")
+		return
+	}
+
+	var broadcast Broadcast
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	switch parts[0] {
+	case "send":
+		broadcast, err = queueBroadcast(id)
+		// Broadcast yang sedang dikirim masih bisa dihentikan
+		stop := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(tr(lang, "broadcast_stop"), callbackBroadcast+"cancel:"+parts[1]),
+		))
+		keyboard = &stop
+	case "cancel":
+		broadcast, _, err = cancelBroadcast(id)
+	default:
+		return
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":        err,
+			"broadcast_id": id,
+		}).Warn("Failed to update broadcast")
+		msg.Text = tr(lang, "broadcast_unavailable")
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, broadcastStatusText(broadcast, lang))
+	edit.ReplyMarkup = keyboard
+	if _, err := bot.Send(edit); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to update broadcast message")
+	}
+}
+
+// handleSubscription opts the user out of broadcasts on /berhenti, or back in on /langganan
+func handleSubscription(ctx *messageContext, unsubscribed bool) {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	if err == nil {
+		db.UpsertUser(ctx.Update.Message.From.ID).Unsubscribed = unsubscribed
+		err = datauser.SaveDatabase(userDataFile, db)
+	}
+	userDataMu.Unlock()
+	if err == nil && !unsubscribed {
+		// Pengguna yang berhenti lalu menghapus datanya hanya tercatat di daftar opt-out
+		err = setBroadcastOptOut(ctx.Update.Message.From.ID, false)
+	}
+	if err != nil {
+		log.Println("Gagal menyimpan data pengguna:", err)
+		ctx.reply(tr(ctx.Lang, "subscription_failed"))
+		return
+	}
+
+	if unsubscribed {
+		ctx.reply(tr(ctx.Lang, "unsubscribed"))
+	} else {
+		ctx.reply(tr(ctx.Lang, "subscribed"))
+	}
+}
+
+// broadcastSummary is a broadcast without its recipient list, as listed by the API
+type broadcastSummary struct {
+	ID         int64          `json:"id"`
+	Text       string         `json:"text"`
+	Segment    string         `json:"segment"`
+	Status     string         `json:"status"`
+	CreatedAt  time.Time      `json:"created_at"`
+	StartedAt  time.Time      `json:"started_at,omitempty"`
+	FinishedAt time.Time      `json:"finished_at,omitempty"`
+	Recipients int            `json:"recipients"`
+	Stats      BroadcastStats `json:"stats"`
+}
+
+// summarizeBroadcast drops the recipient list of a broadcast
+func summarizeBroadcast(broadcast Broadcast) broadcastSummary {
+	return broadcastSummary{
+		ID:         broadcast.ID,
+		Text:       broadcast.Text,
+		Segment:    broadcast.Segment,
+		Status:     broadcast.Status,
+		CreatedAt:  broadcast.CreatedAt,
+		StartedAt:  broadcast.StartedAt,
+		FinishedAt: broadcast.FinishedAt,
+		Recipients: len(broadcast.Recipients),
+		Stats:      broadcast.Stats(),
+	}
+}
+
+// broadcastRequest is the body of POST /broadcasts
+type broadcastRequest struct {
+	Text    string `json:"text"`
+	Segment string `json:"segment"`
+	// Preview only counts the recipients and renders the message, nothing is sent
+	Preview bool `json:"preview"`
+}
+
+// Broadcasts registers the admin broadcast API used by the dashboard:
+// GET /broadcasts lists them, POST /broadcasts previews or sends one, POST /broadcasts/:id/cancel stops one
+func Broadcasts(app *fiber.App) {
+	app.Get("/broadcasts", requireAdminToken, handleListBroadcasts)
+	app.Post("/broadcasts", requireAdminToken, handleCreateBroadcast)
+	app.Post("/broadcasts/:id/cancel", requireAdminToken, handleCancelBroadcast)
+}
+
+func handleListBroadcasts(c *fiber.Ctx) error {
+	broadcastsMu.Lock()
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	broadcastsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load broadcasts")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load broadcasts"})
+	}
+
+	summaries := []broadcastSummary{}
+	for i := len(broadcasts) - 1; i >= 0; i-- {
+		summaries = append(summaries, summarizeBroadcast(broadcasts[i]))
+	}
+	return c.JSON(summaries)
+}
+
+func handleCreateBroadcast(c *fiber.Ctx) error {
+	var request broadcastRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	request.Text = strings.TrimSpace(request.Text)
+	if request.Text == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "text is required"})
+	}
+	segment, ok := normalizeSegment(request.Segment)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown segment " + request.Segment})
+	}
+
+	if request.Preview {
+		recipients, err := broadcastRecipients(segment, time.Now())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to load user data")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load users"})
+		}
+		return c.JSON(fiber.Map{
+			"segment":    segment,
+			"recipients": len(recipients),
+			"text":       broadcastText(request.Text, defaultLanguage),
+		})
+	}
+
+	broadcast, err := createBroadcast(request.Text, segment, 0)
+	if err == nil {
+		broadcast, err = queueBroadcast(broadcast.ID)
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to create broadcast")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create broadcast"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(summarizeBroadcast(broadcast))
+}
+
+func handleCancelBroadcast(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid broadcast ID"})
+	}
+	broadcast, found, err := cancelBroadcast(id)
+	if !found {
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to load broadcasts")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load broadcasts"})
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "broadcast not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(summarizeBroadcast(broadcast))
+}
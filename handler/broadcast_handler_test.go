@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBroadcastResumesFromPartiallySavedProgress(t *testing.T) {
+	chdirTemp(t)
+	now := time.Now()
+	broadcast := Broadcast{
+		ID:     1,
+		Text:   "Ada buku baru!",
+		Status: BroadcastSending,
+		Recipients: []BroadcastRecipient{
+			{UserID: 11, Status: DeliveryDelivered, SentAt: now},
+			{UserID: 12, Status: DeliveryPending},
+			{UserID: 13, Status: DeliveryPending},
+			{UserID: 14, Status: DeliveryPending},
+			{UserID: 15, Status: DeliveryPending},
+		},
+	}
+	if err := saveBroadcasts(broadcastsFile, []Broadcast{broadcast}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Worker berhenti sebelum kelompoknya disimpan: status 12 dan 13 hanya ada di log,
+	// dan baris untuk 14 terpotong di tengah penulisan
+	if err := appendBroadcastProgress(1, BroadcastRecipient{UserID: 12, Status: DeliveryDelivered, SentAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendBroadcastProgress(1, BroadcastRecipient{UserID: 13, Status: DeliveryBlocked, Error: "Forbidden", SentAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	progressFile := broadcastProgressFile(broadcastsFile)
+	data, err := ioutil.ReadFile(progressFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(progressFile, append(data, []byte(`{"broadcast_id":1,"user_id":14,"sta`)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, found := nextBroadcastJob()
+	if !found {
+		t.Fatal("no broadcast job to resume")
+	}
+	if want := []int64{14, 15}; !reflect.DeepEqual(job.Recipients, want) {
+		t.Fatalf("resumed recipients = %v, want %v", job.Recipients, want)
+	}
+
+	var mu sync.Mutex
+	var messaged []string
+	bot := newTestBot(t, func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		messaged = append(messaged, r.FormValue("chat_id"))
+	})
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	sendBroadcast(newSender(bot, 0), job, ticker)
+
+	if want := []string{"14", "15"}; !reflect.DeepEqual(messaged, want) {
+		t.Errorf("messaged %v, want %v", messaged, want)
+	}
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[int64]string)
+	for _, recipient := range broadcasts[0].Recipients {
+		statuses[recipient.UserID] = recipient.Status
+	}
+	want := map[int64]string{11: DeliveryDelivered, 12: DeliveryDelivered, 13: DeliveryBlocked, 14: DeliveryDelivered, 15: DeliveryDelivered}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if _, err := os.Stat(progressFile); !os.IsNotExist(err) {
+		t.Errorf("progress log still exists after the broadcasts file was saved: %v", err)
+	}
+}
+
+func TestBroadcastStopsRightAfterCancellation(t *testing.T) {
+	chdirTemp(t)
+	var recipients []BroadcastRecipient
+	for userID := int64(1); userID <= 10; userID++ {
+		recipients = append(recipients, BroadcastRecipient{UserID: userID, Status: DeliveryPending})
+	}
+	if err := saveBroadcasts(broadcastsFile, []Broadcast{{ID: 2, Text: "Promo", Status: BroadcastSending, Recipients: recipients}}); err != nil {
+		t.Fatal(err)
+	}
+	job, found := nextBroadcastJob()
+	if !found {
+		t.Fatal("no broadcast job")
+	}
+
+	sent := 0
+	bot := newTestBot(t, func(r *http.Request) {
+		sent++
+		if sent == 3 {
+			if _, _, err := cancelBroadcast(2); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	sendBroadcast(newSender(bot, 0), job, ticker)
+
+	if sent != 3 {
+		t.Errorf("sent %d messages, want 3", sent)
+	}
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := broadcasts[0].Stats(); stats.Delivered != 3 || stats.Pending != 7 || broadcasts[0].Status != BroadcastCancelled {
+		t.Errorf("broadcast = %s with %+v, want cancelled with 3 delivered", broadcasts[0].Status, stats)
+	}
+}
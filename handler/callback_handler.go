@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Callback data prefixes of the inline keyboard buttons
+const (
+	callbackReview     = "review:"
+	callbackRateBook   = "rate_book:"
+	callbackRate       = "rate:"
+	callbackModerate   = "moderate:"
+	callbackGroup      = "group:"
+	callbackStore      = "store:"
+	callbackDeleteData = "delete_data:"
+	callbackBroadcast  = "broadcast:"
+	// callbackCategories is a whole callback data, the others are prefixes
+	callbackCategories = "categories"
+	callbackCategory   = "category:"
+	callbackProduct    = "product:"
+	callbackUserReview = "user_reviews:"
+)
+
+// handleCallback handles presses on inline keyboard buttons
+func handleCallback(update *tgbotapi.Update, bot *tgbotapi.BotAPI, catalog *Catalog, reviewLinks []ReviewLink, entry *logrus.Entry) {
+	query := update.CallbackQuery
+	entry = entry.WithFields(logrus.Fields{
+		"user_id_hash": hashID(query.From.ID),
+		"callback":     callbackName(query.Data),
+	})
+	entry.Info("Callback received")
+
+	// Hentikan animasi loading pada tombol
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		entry.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to answer callback query")
+	}
+
+	if query.Message == nil {
+		return
+	}
+
+	lang := userLanguage(query.Message.Chat.ID, query.From.ID, query.From.LanguageCode)
+	products := catalog.Products()
+	msg := tgbotapi.NewMessage(query.Message.Chat.ID, "")
+	out := newSender(bot, query.From.ID)
+
+	switch {
+	case strings.HasPrefix(query.Data, callbackReview):
+		handleReviewCallback(strings.TrimPrefix(query.Data, callbackReview), reviewLinks, lang, &msg)
+	case strings.HasPrefix(query.Data, callbackRateBook):
+		handleRateBookCallback(query.Message.Chat.ID, query.From.ID, strings.TrimPrefix(query.Data, callbackRateBook), products, lang, &msg)
+	case strings.HasPrefix(query.Data, callbackRate):
+		handleRateCallback(query.Message.Chat.ID, query.From.ID, strings.TrimPrefix(query.Data, callbackRate), lang, &msg)
+	case strings.HasPrefix(query.Data, callbackModerate):
+		handleModerateCallback(out, query, strings.TrimPrefix(query.Data, callbackModerate), lang, &msg)
+	case query.Data == callbackCategories:
+		handleCategoryCallback(out, query, "", products, lang)
+	case strings.HasPrefix(query.Data, callbackCategory):
+		handleCategoryCallback(out, query, strings.TrimPrefix(query.Data, callbackCategory), products, lang)
+	case strings.HasPrefix(query.Data, callbackProduct):
+		handleProductCallback(out, query, strings.TrimPrefix(query.Data, callbackProduct), products, lang)
+	case strings.HasPrefix(query.Data, callbackUserReview):
+		handleUserReviewsCallback(strings.TrimPrefix(query.Data, callbackUserReview), products, lang, &msg)
+	case strings.HasPrefix(query.Data, callbackStore):
+		handleStoreCallback(query, strings.TrimPrefix(query.Data, callbackStore), products, lang, &msg)
+	case strings.HasPrefix(query.Data, callbackDeleteData):
+		handleDeleteDataCallback(out, query, strings.TrimPrefix(query.Data, callbackDeleteData), lang)
+	case strings.HasPrefix(query.Data, callbackBroadcast):
+		handleBroadcastCallback(out, query, strings.TrimPrefix(query.Data, callbackBroadcast), lang, &msg)
+	case strings.HasPrefix(query.Data, callbackGroup):
+		handleGroupCallback(out, query, strings.TrimPrefix(query.Data, callbackGroup), lang, &msg)
+	}
+
+	if msg.Text != "" {
+		if _, err := out.Send(msg); err != nil {
+			entry.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to send message")
+		}
+	}
+
+	saveBotMessages(out.sent)
+}
+
+// handleReviewCallback sends the review link of the book picked from the disambiguation keyboard
+func handleReviewCallback(data string, reviewLinks []ReviewLink, lang string, msg *tgbotapi.MessageConfig) {
+	index, err := strconv.Atoi(data)
+	if err != nil || index < 0 || index >= len(reviewLinks) {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid review callback data")
+		return
+	}
+
+	reviewLink := reviewLinks[index]
+	msg.Text = tr(lang, "review_found", reviewLink.ProductName, reviewLink.Link)
+}
+
+// maxProductKeyLength keeps a product key and the longest callback prefix within the 64 bytes of callback data
+const maxProductKeyLength = 48
+
+// productKey returns the key naming a product in callback data: its API identifier, or a hash of it when the
+// identifier is too long. Unlike an index into the product list, it still names the same book after catalog changes.
+func productKey(name string) string {
+	id := productID(name)
+	if len(id) <= maxProductKeyLength {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "#" + hex.EncodeToString(sum[:16])
+}
+
+// findProductByKey returns the catalog product named by a callback key
+func findProductByKey(products []Product, key string) (*Product, bool) {
+	for i := range products {
+		if productKey(products[i].Nama) == key {
+			return &products[i], true
+		}
+	}
+	return nil, false
+}
+
+// callbackName returns the prefix of callback data, which names the button without the IDs it carries
+func callbackName(data string) string {
+	if i := strings.Index(data, ":"); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
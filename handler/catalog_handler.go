@@ -0,0 +1,437 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const catalogChangesFile = "catalog_changes.json"
+
+// maxCatalogSuggestions limits the titles suggested when an admin command names an unknown book
+const maxCatalogSuggestions = 3
+
+// Actions of a catalog change
+const (
+	CatalogAdd     = "add"
+	CatalogEdit    = "edit"
+	CatalogDelete  = "delete"
+	CatalogAddLink = "add_link"
+)
+
+// titleKeys are the admin command keys that rename a book
+var titleKeys = map[string]bool{"judul": true, "title": true}
+
+// CatalogChange is a change made to the catalog by an admin. Changes are replayed over products.txt
+// on startup, so the text file stays the base catalog and the admin changes survive redeploys.
+type CatalogChange struct {
+	Action    string      `json:"action"`
+	Product   string      `json:"product"`
+	Name      string      `json:"name,omitempty"`
+	Category  string      `json:"category,omitempty"`
+	Links     []StoreLink `json:"links,omitempty"`
+	UserID    int64       `json:"user_id"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// catalogError is a rejected catalog change, described to the admin by the catalog message Key
+type catalogError struct {
+	Key string
+	Arg string
+}
+
+func (e *catalogError) Error() string {
+	return e.Key + ": " + e.Arg
+}
+
+// Catalog is the product catalog shared by the handlers. Changes replace the product list instead of
+// modifying it, so a list returned by Products stays valid while an update is being handled.
+type Catalog struct {
+	mu          sync.RWMutex
+	products    []Product
+	reviewLinks []ReviewLink
+	version     int
+	// renamed maps the old title of a book renamed with /editbuku to its new title
+	renamed map[string]string
+}
+
+// OpenCatalog builds the catalog from the products loaded from products.txt and replays the admin changes.
+// Changes that no longer apply, e.g. the edit of a book since removed from products.txt, are skipped.
+func OpenCatalog(products []Product, reviewLinks []ReviewLink) (*Catalog, error) {
+	catalog := &Catalog{products: products, reviewLinks: reviewLinks, renamed: make(map[string]string)}
+
+	changes, err := loadCatalogChanges(catalogChangesFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		updated, err := catalog.applyChange(catalog.products, change)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"action":  change.Action,
+				"product": change.Product,
+				"error":   err,
+			}).Warn("Skipping catalog change that no longer applies")
+			continue
+		}
+		catalog.recordRename(catalog.products, change)
+		catalog.products = updated
+	}
+
+	if len(changes) > 0 {
+		if err := saveProductsToJson(catalog.products, "products.json"); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+// Products returns the current product list. It must not be modified.
+func (c *Catalog) Products() []Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.products
+}
+
+// Version returns a number that changes every time the catalog does
+func (c *Catalog) Version() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// Apply validates a change, saves it and makes it visible to the following searches
+func (c *Catalog) Apply(change CatalogChange) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	updated, err := c.applyChange(c.products, change)
+	if err != nil {
+		return err
+	}
+
+	changes, err := loadCatalogChanges(catalogChangesFile)
+	if err != nil {
+		return err
+	}
+	if err := saveCatalogChanges(catalogChangesFile, append(changes, change)); err != nil {
+		return err
+	}
+	if err := saveProductsToJson(updated, "products.json"); err != nil {
+		// Perubahan sudah tersimpan di catalog_changes.json, products.json hanya salinan
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to save products to JSON")
+	}
+
+	if oldName, renamed := c.recordRename(c.products, change); renamed {
+		if err := renameUserReviews(oldName, change.Name); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"product": oldName,
+				"error":   err,
+			}).Error("Failed to move the reviews of a renamed book")
+		}
+	}
+	c.products = updated
+	c.version++
+	return nil
+}
+
+// Lookup returns the current product with the given title, following the renames made with /editbuku so
+// redirect links and conversations started before a rename keep working
+func (c *Catalog) Lookup(name string) (*Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Batasi jumlah langkah agar rantai ganti nama yang berputar tidak membuat loop tanpa akhir
+	for i := 0; i <= len(c.renamed); i++ {
+		if product, found := findProductByName(c.products, name); found {
+			return product, true
+		}
+		next, renamed := c.renamed[name]
+		if !renamed {
+			break
+		}
+		name = next
+	}
+	return nil, false
+}
+
+// recordRename remembers the old title of a book renamed by an applied change and returns it
+func (c *Catalog) recordRename(products []Product, change CatalogChange) (string, bool) {
+	if change.Action != CatalogEdit || change.Name == "" {
+		return "", false
+	}
+	index := findCatalogProduct(products, change.Product)
+	if index < 0 || products[index].Nama == change.Name {
+		return "", false
+	}
+	oldName := products[index].Nama
+	c.renamed[oldName] = change.Name
+	return oldName, true
+}
+
+// applyChange returns a copy of products with the change applied
+func (c *Catalog) applyChange(products []Product, change CatalogChange) ([]Product, error) {
+	for _, link := range change.Links {
+		if !isStoreURL(link.URL) {
+			return nil, &catalogError{Key: "catalog_invalid_link", Arg: link.URL}
+		}
+	}
+
+	index := findCatalogProduct(products, change.Product)
+	if change.Action != CatalogAdd && index < 0 {
+		return nil, &catalogError{Key: "catalog_not_found", Arg: change.Product}
+	}
+	if change.Name != "" {
+		if existing := findCatalogProduct(products, change.Name); existing >= 0 && existing != index {
+			return nil, &catalogError{Key: "catalog_exists", Arg: products[existing].Nama}
+		}
+	}
+
+	updated := make([]Product, len(products), len(products)+1)
+	copy(updated, products)
+
+	switch change.Action {
+	case CatalogAdd:
+		if index >= 0 {
+			return nil, &catalogError{Key: "catalog_exists", Arg: products[index].Nama}
+		}
+		product := Product{Nama: change.Product, Category: change.Category}
+		if product.Category == "" {
+			product.Category = inferCategory(product.Nama)
+		}
+		for _, link := range change.Links {
+			product.setLink(link.Store, link.URL)
+		}
+		updated = append(updated, product)
+		c.attachReviewLink(&updated[len(updated)-1])
+	case CatalogEdit:
+		product := &updated[index]
+		if change.Name != "" {
+			product.Nama = change.Name
+			c.attachReviewLink(product)
+		}
+		if change.Category != "" {
+			product.Category = change.Category
+		}
+	case CatalogDelete:
+		updated = append(updated[:index], updated[index+1:]...)
+	case CatalogAddLink:
+		// Salin link agar daftar produk lama yang masih dipakai tidak ikut berubah
+		product := &updated[index]
+		product.Links = append([]StoreLink(nil), product.Links...)
+		for _, link := range change.Links {
+			product.setLink(link.Store, link.URL)
+		}
+	default:
+		return nil, fmt.Errorf("unknown catalog action %q", change.Action)
+	}
+	return updated, nil
+}
+
+// attachReviewLink sets the review link of a product from the review list, as done on load
+func (c *Catalog) attachReviewLink(product *Product) {
+	product.ReviewLink = ""
+	for _, reviewLink := range c.reviewLinks {
+		if isReviewURL(reviewLink.Link) && normalizeText(reviewLink.ProductName) == normalizeText(product.Nama) {
+			product.ReviewLink = reviewLink.Link
+			return
+		}
+	}
+}
+
+// findCatalogProduct returns the index of the product with the given title, ignoring case and punctuation, or -1
+func findCatalogProduct(products []Product, name string) int {
+	normalized := normalizeText(name)
+	for i := range products {
+		if normalizeText(products[i].Nama) == normalized {
+			return i
+		}
+	}
+	return -1
+}
+
+// isStoreURL reports whether link is an absolute http(s) URL with a host name
+func isStoreURL(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	return strings.Contains(parsed.Hostname(), ".")
+}
+
+// loadCatalogChanges loads the admin changes to the catalog from a JSON file
+func loadCatalogChanges(filename string) ([]CatalogChange, error) {
+	var changes []CatalogChange
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return changes, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &changes)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// saveCatalogChanges saves the admin changes to the catalog to a JSON file
+func saveCatalogChanges(filename string, changes []CatalogChange) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// parseCatalogArgs splits the arguments of a catalog command into the book title, on the first line,
+// and the "key: value" lines that follow, e.g.
+//
+//	/tambahbuku Belajar Go
+//	Kategori: Pemrograman
+//	Gramedia: https://www.gramedia.com/products/belajar-go
+func parseCatalogArgs(args string) (string, [][2]string, bool) {
+	lines := strings.Split(strings.TrimSpace(args), "\n")
+	title := strings.TrimSpace(lines[0])
+	var fields [][2]string
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return title, nil, false
+		}
+		fields = append(fields, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	return title, fields, title != ""
+}
+
+// catalogReply describes the outcome of a catalog change to the admin
+func catalogReply(ctx *messageContext, err error, done string) {
+	if err == nil {
+		ctx.reply(done)
+		return
+	}
+	if e, ok := err.(*catalogError); ok {
+		text := tr(ctx.Lang, e.Key, e.Arg)
+		if e.Key == "catalog_not_found" {
+			text += catalogSuggestions(ctx, e.Arg)
+		}
+		ctx.reply(text)
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("Failed to change the catalog")
+	ctx.reply(tr(ctx.Lang, "catalog_failed"))
+}
+
+// catalogSuggestions lists the titles closest to an unknown title, so the admin can copy the exact one
+func catalogSuggestions(ctx *messageContext, title string) string {
+	matches := findProducts(ctx.Catalog.Products(), title)
+	if len(matches) == 0 {
+		return ""
+	}
+	if len(matches) > maxCatalogSuggestions {
+		matches = matches[:maxCatalogSuggestions]
+	}
+	var b strings.Builder
+	b.WriteString("\n" + tr(ctx.Lang, "catalog_suggestions"))
+	for _, product := range matches {
+		b.WriteString("\n• " + product.Nama)
+	}
+	return b.String()
+}
+
+// newCatalogChange starts a change made by the admin who sent the command
+func newCatalogChange(ctx *messageContext, action, product string) CatalogChange {
+	return CatalogChange{Action: action, Product: product, UserID: ctx.Update.Message.From.ID, Timestamp: time.Now()}
+}
+
+// handleAddBook adds a book to the catalog on /tambahbuku, with its category and store links
+func handleAddBook(ctx *messageContext) {
+	title, fields, ok := parseCatalogArgs(ctx.Args)
+	if !ok {
+		ctx.reply(tr(ctx.Lang, "catalog_usage_add"))
+		return
+	}
+
+	change := newCatalogChange(ctx, CatalogAdd, title)
+	for _, field := range fields {
+		if categoryKeys[strings.ToLower(field[0])] {
+			change.Category = field[1]
+			continue
+		}
+		change.Links = append(change.Links, StoreLink{Store: normalizeStoreName(field[0]), URL: field[1]})
+	}
+	catalogReply(ctx, ctx.Catalog.Apply(change), tr(ctx.Lang, "catalog_added", title))
+}
+
+// handleEditBook renames a book or changes its category on /editbuku
+func handleEditBook(ctx *messageContext) {
+	title, fields, ok := parseCatalogArgs(ctx.Args)
+	if !ok || len(fields) == 0 {
+		ctx.reply(tr(ctx.Lang, "catalog_usage_edit"))
+		return
+	}
+
+	change := newCatalogChange(ctx, CatalogEdit, title)
+	for _, field := range fields {
+		key := strings.ToLower(field[0])
+		switch {
+		case titleKeys[key]:
+			change.Name = field[1]
+		case categoryKeys[key]:
+			change.Category = field[1]
+		default:
+			ctx.reply(tr(ctx.Lang, "catalog_usage_edit"))
+			return
+		}
+	}
+	catalogReply(ctx, ctx.Catalog.Apply(change), tr(ctx.Lang, "catalog_edited", title))
+}
+
+// handleDeleteBook removes a book from the catalog on /hapusbuku
+func handleDeleteBook(ctx *messageContext) {
+	title, fields, ok := parseCatalogArgs(ctx.Args)
+	if !ok || len(fields) > 0 {
+		ctx.reply(tr(ctx.Lang, "catalog_usage_delete"))
+		return
+	}
+
+	change := newCatalogChange(ctx, CatalogDelete, title)
+	catalogReply(ctx, ctx.Catalog.Apply(change), tr(ctx.Lang, "catalog_deleted", title))
+}
+
+// handleAddLink adds store links to a book on /tambahlink, replacing the link of a store it already has
+func handleAddLink(ctx *messageContext) {
+	title, fields, ok := parseCatalogArgs(ctx.Args)
+	if !ok || len(fields) == 0 {
+		ctx.reply(tr(ctx.Lang, "catalog_usage_link"))
+		return
+	}
+
+	change := newCatalogChange(ctx, CatalogAddLink, title)
+	var stores []string
+	for _, field := range fields {
+		store := normalizeStoreName(field[0])
+		change.Links = append(change.Links, StoreLink{Store: store, URL: field[1]})
+		stores = append(stores, store)
+	}
+	catalogReply(ctx, ctx.Catalog.Apply(change), tr(ctx.Lang, "catalog_link_added", strings.Join(stores, ", "), title))
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultCategory is the category of products that match no category rule
+const defaultCategory = "Lainnya"
+
+// categoryPageSize is the number of books listed per page when browsing a category
+const categoryPageSize = 8
+
+// categoryRule infers a category from keywords found in the normalized product name. Keywords match whole
+// words, a keyword ending in "*" matches the words starting with it, e.g. "hack*" matches hacker and hacking.
+type categoryRule struct {
+	Category string
+	Keywords []string
+}
+
+// categoryRules are checked in order, the first rule with a matching keyword wins
+var categoryRules = []categoryRule{
+	{"Hacking & Keamanan", []string{"hack*", "meretas", "peretas", "kali linux", "nmap", "metasploit*", "security", "keamanan", "cyber", "siber", "forensic", "firewall", "ddos", "attack"}},
+	{"Data & AI", []string{"machine learning", "deep learning", "artificial intelligence", "ai", "data mining", "data science", "big data", "text mining", "data analysis", "analis data", "scikit"}},
+	{"Trading & Investasi", []string{"trading", "investasi", "investing", "saham", "forex", "crypto*", "money", "bandarmology"}},
+	{"Jaringan & Sistem", []string{"jaringan", "mikrotik", "cisco", "linux", "tcp ip", "ipv6", "wireless", "nirkabel", "server", "cloud", "sistem operasi", "openbts", "fiber optic"}},
+	{"Elektronika & IoT", []string{"arduino", "raspberry", "microcontroller", "mikrokontroler", "iot", "robot*", "elektronika", "sensor", "proteus"}},
+	{"Web & Blog", []string{"wordpress", "blog*", "seo", "website", "toko online", "web desain", "online shop"}},
+	{"Pemrograman", []string{"pemrograman", "pemerograman", "programmer", "programer", "programming", "python", "java", "javascript", "php", "laravel", "flutter", "android", "c++", "algoritma", "struktur data", "database", "sql", "mysql", "nosql", "django", "scratch", "oop", "vue"}},
+	{"Bisnis & Kepemimpinan", []string{"bisnis", "berbisnis", "kepemimpinan", "leadership", "jack ma", "ekonomi", "marketing", "market", "profit", "daya saing", "bergaji"}},
+	{"Pengembangan Diri", []string{"psychology", "habit*", "mindset", "daya baca", "anak", "focus", "motivasi", "sukses"}},
+	{"Agama", []string{"shalat", "sholat", "islam", "quran", "iqro", "doa", "kristus", "alkitab", "hadits"}},
+	{"Pendidikan", []string{"matematika", "kelas", "buku ajar", "mahasiswa", "mewarnai", "dictionary", "kamus"}},
+	{"Komik & Manga", []string{"manga", "komik", "one piece", "one punch", "jujutsu", "black butler", "fairy tail", "slime", "komi", "conan", "naruto", "his cat", "bonobono", "bono bono", "seraph", "miiko", "fire force", "black clover", "neverland", "kariage", "harem", "hanako", "moriarty"}},
+	{"Alat Tulis & Kantor", []string{"office", "officeplus", "sticky note", "binder", "clip", "tape", "id card", "lanyard", "gunting", "magnet", "name tag", "page marker", "stationery", "pulpen", "pensil"}},
+}
+
+// categoryCount is a category with the number of books in it
+type categoryCount struct {
+	Name  string
+	Count int
+}
+
+// inferCategory guesses the category of a product from its name
+func inferCategory(name string) string {
+	padded := " " + normalizeText(name) + " "
+	// normalizeText drops symbols, so "C++" is checked on the lowercased name
+	lower := strings.ToLower(name)
+	for _, rule := range categoryRules {
+		for _, keyword := range rule.Keywords {
+			if matchesKeyword(padded, keyword) || (strings.ContainsAny(keyword, "+#") && strings.Contains(lower, keyword)) {
+				return rule.Category
+			}
+		}
+	}
+	return defaultCategory
+}
+
+// matchesKeyword reports whether a category keyword appears in a normalized name padded with spaces
+func matchesKeyword(padded, keyword string) bool {
+	if prefix := strings.TrimSuffix(keyword, "*"); prefix != keyword {
+		return strings.Contains(padded, " "+prefix)
+	}
+	return strings.Contains(padded, " "+keyword+" ")
+}
+
+// assignCategories fills in the category of the products that don't have one in the catalog file
+func assignCategories(products []Product) {
+	for i := range products {
+		if products[i].Category == "" {
+			products[i].Category = inferCategory(products[i].Nama)
+		}
+	}
+}
+
+// productCategories lists the categories of the catalog by name, with "Lainnya" last
+func productCategories(products []Product) []categoryCount {
+	counts := make(map[string]int)
+	for _, product := range products {
+		counts[product.Category]++
+	}
+
+	var categories []categoryCount
+	for name, count := range counts {
+		categories = append(categories, categoryCount{Name: name, Count: count})
+	}
+	sort.Slice(categories, func(a, b int) bool {
+		if (categories[a].Name == defaultCategory) != (categories[b].Name == defaultCategory) {
+			return categories[b].Name == defaultCategory
+		}
+		return categories[a].Name < categories[b].Name
+	})
+	return categories
+}
+
+// maxCategorySlugLength keeps a category slug short enough for callback data, which is limited to 64 bytes
+const maxCategorySlugLength = 32
+
+// categorySlug is the short form of a category used in callback data. A long name is cut and suffixed with
+// a hash of the whole name, so two categories sharing a long prefix still get different slugs.
+func categorySlug(category string) string {
+	slug := strings.ReplaceAll(normalizeText(category), " ", "_")
+	if len(slug) > maxCategorySlugLength {
+		sum := sha256.Sum256([]byte(slug))
+		slug = slug[:maxCategorySlugLength-9] + "_" + hex.EncodeToString(sum[:4])
+	}
+	return slug
+}
+
+// findCategory returns the category whose slug is given
+func findCategory(products []Product, slug string) (string, bool) {
+	for _, category := range productCategories(products) {
+		if categorySlug(category.Name) == slug {
+			return category.Name, true
+		}
+	}
+	return "", false
+}
+
+// categoryKeyboard shows every category as a button, two per row
+func categoryKeyboard(products []Product) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, category := range productCategories(products) {
+		label := fmt.Sprintf("%s (%d)", category.Name, category.Count)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, callbackCategory+categorySlug(category.Name)+":0"))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// categoryPage renders one page of the books in a category, each book a button, with navigation buttons
+func categoryPage(products []Product, category string, page int, lang string) (string, tgbotapi.InlineKeyboardMarkup) {
+	var indexes []int
+	for i := range products {
+		if products[i].Category == category {
+			indexes = append(indexes, i)
+		}
+	}
+
+	pages := (len(indexes) + categoryPageSize - 1) / categoryPageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	end := (page + 1) * categoryPageSize
+	if end > len(indexes) {
+		end = len(indexes)
+	}
+	for _, index := range indexes[page*categoryPageSize : end] {
+		button := tgbotapi.NewInlineKeyboardButtonData(products[index].Nama, callbackProduct+productKey(products[index].Nama))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+
+	slug := categorySlug(category)
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "page_prev"), callbackCategory+slug+":"+strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "page_next"), callbackCategory+slug+":"+strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "category_back"), callbackCategories)))
+
+	text := tr(lang, "category_page", category, len(indexes), page+1, pages)
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleCategories shows the categories of the catalog on /kategori, or a category directly if one is given
+func handleCategories(ctx *messageContext) {
+	if ctx.Args != "" {
+		categories := productCategories(ctx.Products)
+		matches := bestMatches(searchNames(len(categories), func(i int) string { return categories[i].Name }, ctx.Args))
+		if len(matches) == 1 {
+			text, keyboard := categoryPage(ctx.Products, categories[matches[0].Index].Name, 0, ctx.Lang)
+			ctx.reply(text)
+			ctx.Msg.ReplyMarkup = keyboard
+			return
+		}
+	}
+
+	ctx.reply(tr(ctx.Lang, "category_choose"))
+	ctx.Msg.ReplyMarkup = categoryKeyboard(ctx.Products)
+}
+
+// handleCategoryCallback turns the category message into the requested page of a category, or back into the category list
+func handleCategoryCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, products []Product, lang string) {
+	var text string
+	var keyboard tgbotapi.InlineKeyboardMarkup
+
+	if data == "" {
+		text, keyboard = tr(lang, "category_choose"), categoryKeyboard(products)
+	} else {
+		parts := strings.SplitN(data, ":", 2)
+		page := 0
+		if len(parts) == 2 {
+			page, _ = strconv.Atoi(parts[1])
+		}
+		category, found := findCategory(products, parts[0])
+		if !found {
+			logrus.WithFields(logrus.Fields{
+				"data": data,
+			}).Warn("Unknown category in callback data")
+			return
+		}
+		text, keyboard = categoryPage(products, category, page, lang)
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, text, keyboard)
+	if _, err := bot.Send(edit); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to update category message")
+	}
+}
+
+// handleProductCallback sends the result message of a book picked from a category page
+func handleProductCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, products []Product, lang string) {
+	product, found := findProductByKey(products, data)
+	if !found {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Unknown product in callback data")
+		return
+	}
+
+	view := storeView{Preferred: userPreferredStore(query.Message.Chat.ID, query.From.ID)}
+	msg := productMessage(query.Message.Chat.ID, query.From.ID, product, loadProductRatings(), view, lang)
+	if _, err := bot.Send(msg); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to send product message")
+	}
+}
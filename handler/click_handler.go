@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// clicksFile is the JSON file holding the store link clicks
+const clicksFile = "clicks.json"
+
+// clickSignatureSize is the number of HMAC bytes kept in a redirect token
+const clickSignatureSize = 16
+
+// previewUserAgents are User-Agent fragments of link preview crawlers. Their requests are redirected
+// without being recorded as clicks.
+var previewUserAgents = []string{"telegrambot", "twitterbot", "facebookexternalhit", "whatsapp", "slackbot", "discordbot"}
+
+// Click is a press on a store link of a search result, recorded by the /go redirect
+type Click struct {
+	UserID    int64     `json:"user_id"`
+	Product   string    `json:"product"`
+	Store     string    `json:"store"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// clicksMu serializes read-modify-write cycles on the clicks file
+var clicksMu sync.Mutex
+
+// loadClicks loads the recorded clicks from a JSON file
+func loadClicks(filename string) ([]Click, error) {
+	var clicks []Click
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return clicks, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &clicks)
+	if err != nil {
+		return nil, err
+	}
+	return clicks, nil
+}
+
+// saveClicks saves the recorded clicks to a JSON file
+func saveClicks(filename string, clicks []Click) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(clicks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// addClick appends a click to the clicks file
+func addClick(click Click) error {
+	clicksMu.Lock()
+	defer clicksMu.Unlock()
+
+	clicks, err := loadClicks(clicksFile)
+	if err != nil {
+		return err
+	}
+	clicks = append(clicks, click)
+	return saveClicks(clicksFile, clicks)
+}
+
+// clickTracking returns the public base URL of the redirect route and the token secret, set with
+// REDIRECT_BASE_URL and REDIRECT_SECRET. Click tracking is off unless both are set.
+func clickTracking() (string, []byte, bool) {
+	baseURL := strings.TrimSuffix(strings.TrimSpace(os.Getenv("REDIRECT_BASE_URL")), "/")
+	secret := os.Getenv("REDIRECT_SECRET")
+	if baseURL == "" || secret == "" {
+		return "", nil, false
+	}
+	return baseURL, []byte(secret), true
+}
+
+// signClickToken builds the redirect token of a store link. The token names the product and store, never the
+// target URL, and carries an HMAC so it can't be forged into an open redirect.
+func signClickToken(secret []byte, userID int64, product, store string) string {
+	payload := []byte(strconv.FormatInt(userID, 10) + "\n" + store + "\n" + product)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	signature := mac.Sum(nil)[:clickSignatureSize]
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// verifyClickToken checks the signature of a redirect token and returns the user, product and store it names
+func verifyClickToken(secret []byte, token string) (int64, string, string, bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return 0, "", "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, "", "", false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)[:clickSignatureSize]) {
+		return 0, "", "", false
+	}
+
+	fields := strings.SplitN(string(payload), "\n", 3)
+	if len(fields) != 3 {
+		return 0, "", "", false
+	}
+	userID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", "", false
+	}
+	return userID, fields[2], fields[1], true
+}
+
+// trackedLinks replaces the store URLs of a result with /go redirect links when click tracking is on
+func trackedLinks(product *Product, links []StoreLink, userID int64) []StoreLink {
+	baseURL, secret, enabled := clickTracking()
+	if !enabled {
+		return links
+	}
+
+	tracked := make([]StoreLink, len(links))
+	for i, link := range links {
+		tracked[i] = StoreLink{
+			Store: link.Store,
+			URL:   baseURL + "/go/" + signClickToken(secret, userID, product.Nama, link.Store),
+		}
+	}
+	return tracked
+}
+
+// findProductByName returns the catalog product with exactly the given name
+func findProductByName(products []Product, name string) (*Product, bool) {
+	for i := range products {
+		if products[i].Nama == name {
+			return &products[i], true
+		}
+	}
+	return nil, false
+}
+
+// isLinkPreview reports whether a request comes from a link preview crawler rather than a user
+func isLinkPreview(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range previewUserAgents {
+		if strings.Contains(userAgent, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redirect registers the /go/<token> route, which records a click on a store link then redirects to the store
+func Redirect(app *fiber.App, catalog *Catalog) {
+	app.Get("/go/:token", func(c *fiber.Ctx) error {
+		return handleRedirect(c, catalog)
+	})
+}
+
+func handleRedirect(c *fiber.Ctx, catalog *Catalog) error {
+	_, secret, enabled := clickTracking()
+	if !enabled {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	userID, productName, store, valid := verifyClickToken(secret, c.Params("token"))
+	if !valid {
+		logrus.WithFields(logrus.Fields{
+			"ip": c.IP(),
+		}).Warn("Invalid redirect token")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	// URL tujuan selalu diambil dari katalog, bukan dari token
+	product, found := catalog.Lookup(productName)
+	if !found {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	productName = product.Nama
+	target, found := product.Link(store)
+	if !found {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if isLinkPreview(c.Get(fiber.HeaderUserAgent)) {
+		logrus.WithFields(logrus.Fields{
+			"product": productName,
+			"store":   store,
+		}).Debug("Not recording a link preview as a click")
+		return c.Redirect(target, fiber.StatusFound)
+	}
+
+	click := Click{UserID: userID, Product: productName, Store: store, Timestamp: time.Now()}
+	if err := addClick(click); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to save click")
+	}
+	attributeClick(click)
+	logrus.WithFields(logrus.Fields{
+		"user_id_hash": hashID(userID),
+		"product":      productName,
+		"store":        store,
+	}).Info("Store link clicked")
+
+	return c.Redirect(target, fiber.StatusFound)
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// chdirTemp runs the test in an empty directory, so the data files of the handlers are written there
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(dir)
+	})
+}
+
+func TestRedirectIgnoresLinkPreviews(t *testing.T) {
+	chdirTemp(t)
+	t.Setenv("REDIRECT_BASE_URL", "https://bot.example.com")
+	t.Setenv("REDIRECT_SECRET", "rahasia")
+
+	product := Product{Nama: "Belajar Go", Links: []StoreLink{{Store: "Gramedia", URL: "https://gramedia.example.com/go"}}}
+	catalog, err := OpenCatalog([]Product{product}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	Redirect(app, catalog)
+	token := signClickToken([]byte("rahasia"), 42, product.Nama, "Gramedia")
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		wantClicks int
+	}{
+		{name: "telegram preview", userAgent: "TelegramBot (like TwitterBot)", wantClicks: 0},
+		{name: "other preview", userAgent: "facebookexternalhit/1.1", wantClicks: 0},
+		{name: "browser", userAgent: "Mozilla/5.0 (Linux; Android 14) Mobile Safari/537.36", wantClicks: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(clicksFile)
+			req := httptest.NewRequest("GET", "/go/"+token, nil)
+			req.Header.Set("User-Agent", test.userAgent)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusFound || resp.Header.Get("Location") != product.Links[0].URL {
+				t.Errorf("got %d to %q, want a redirect to the store", resp.StatusCode, resp.Header.Get("Location"))
+			}
+
+			clicks, err := loadClicks(clicksFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clicks) != test.wantClicks {
+				t.Errorf("recorded %d clicks, want %d", len(clicks), test.wantClicks)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// messageContext carries what a command or conversation handler needs to answer a message
+type messageContext struct {
+	Update         *tgbotapi.Update
+	Bot            *sender
+	Catalog        *Catalog
+	Products       []Product
+	ReviewLinks    []ReviewLink
+	Lang           string
+	Args           string
+	InConversation bool
+	Group          *GroupSettings
+	Msg            *tgbotapi.MessageConfig
+	Results        []string
+	Log            *logrus.Entry
+	// Implicit is set for a group message searched only because the group searches every message
+	Implicit bool
+}
+
+// ChatID returns the chat the message was sent in
+func (ctx *messageContext) ChatID() int64 {
+	return ctx.Update.Message.Chat.ID
+}
+
+// UserID returns the user who sent the message
+func (ctx *messageContext) UserID() int64 {
+	return ctx.Update.Message.From.ID
+}
+
+// reply sets the text of the answer, sent once the handler returns
+func (ctx *messageContext) reply(text string) {
+	ctx.Msg.Text = text
+}
+
+// command is a bot command handled by the router
+type command struct {
+	Name      string
+	Aliases   []string
+	AdminOnly bool
+	Run       func(ctx *messageContext)
+}
+
+// parsedCommand is a command found at the start of a message
+type parsedCommand struct {
+	Name     string
+	Args     string
+	OtherBot bool
+	// ToBot is set when the command names this bot, like /start@BookFinderBot
+	ToBot bool
+}
+
+// commands lists every command the bot understands, in the order shown by /help.
+// The description of each command is the catalog message "cmd_<name>", its detailed help "cmd_<name>_help".
+var commands []command
+
+func init() {
+	commands = []command{
+		{Name: "start", Run: runStart},
+		{Name: "help", Aliases: []string{"bantuan"}, Run: runHelp},
+		{Name: "kategori", Aliases: []string{"category", "categories"}, Run: runCategories},
+		{Name: "toko", Aliases: []string{"store"}, Run: runStore},
+		{Name: "ulasan", Aliases: []string{"review"}, Run: runReview},
+		{Name: "beriulasan", Aliases: []string{"tulisulasan"}, Run: runSubmitReview},
+		{Name: "bahasa", Aliases: []string{"language", "lang"}, Run: runLanguage},
+		{Name: "batal", Aliases: []string{"cancel"}, Run: runCancel},
+		{Name: "datasaya", Aliases: []string{"mydata"}, Run: runDataExport},
+		{Name: "hapusdata", Aliases: []string{"deletedata"}, Run: runDataDeletion},
+		{Name: "berhenti", Aliases: []string{"unsubscribe"}, Run: runUnsubscribe},
+		{Name: "langganan", Aliases: []string{"subscribe"}, Run: runSubscribe},
+		{Name: "pengaturan", Aliases: []string{"settings"}, Run: runGroupSettings},
+		{Name: "moderasi", AdminOnly: true, Run: runModeration},
+		{Name: "broadcast", AdminOnly: true, Run: runBroadcast},
+		{Name: "tambahbuku", Aliases: []string{"addbook"}, AdminOnly: true, Run: runAddBook},
+		{Name: "editbuku", Aliases: []string{"editbook"}, AdminOnly: true, Run: runEditBook},
+		{Name: "hapusbuku", Aliases: []string{"deletebook"}, AdminOnly: true, Run: runDeleteBook},
+		{Name: "tambahlink", Aliases: []string{"addlink"}, AdminOnly: true, Run: runAddLink},
+	}
+}
+
+// findCommand looks up a command by name or alias
+func findCommand(name string) (*command, bool) {
+	name = strings.ToLower(name)
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i], true
+		}
+		for _, alias := range commands[i].Aliases {
+			if alias == name {
+				return &commands[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseCommand extracts the command from a message using its bot_command entity.
+// Commands addressed to another bot, like /start@OtherBot, are flagged with OtherBot.
+func parseCommand(message *tgbotapi.Message, botUsername string) (parsedCommand, bool) {
+	if !message.IsCommand() {
+		return parsedCommand{}, false
+	}
+
+	parsed := parsedCommand{
+		Name: strings.ToLower(message.Command()),
+		Args: strings.TrimSpace(message.CommandArguments()),
+	}
+	if withAt := message.CommandWithAt(); strings.Contains(withAt, "@") {
+		mention := withAt[strings.Index(withAt, "@")+1:]
+		parsed.OtherBot = !strings.EqualFold(mention, botUsername)
+		parsed.ToBot = !parsed.OtherBot
+	}
+	return parsed, true
+}
+
+// runCommand dispatches a parsed command to its handler
+func runCommand(ctx *messageContext, parsed parsedCommand) {
+	cmd, found := findCommand(parsed.Name)
+	if !found {
+		// Nama perintah yang tidak dikenal tidak dijadikan label agar jumlah seri metrik tetap terbatas
+		metrics.CommandsHandled.Inc("unknown")
+		ctx.reply(tr(ctx.Lang, "unknown_command", parsed.Name))
+		return
+	}
+	metrics.CommandsHandled.Inc(cmd.Name)
+	if cmd.AdminOnly && !isAdmin(ctx.Update.Message.From.ID) {
+		ctx.reply(tr(ctx.Lang, "admin_only"))
+		return
+	}
+
+	ctx.Args = parsed.Args
+	cmd.Run(ctx)
+}
+
+// commandList renders the public commands with their descriptions, one per line
+func commandList(lang string) string {
+	var b strings.Builder
+	for _, cmd := range commands {
+		if cmd.AdminOnly {
+			continue
+		}
+		b.WriteString("/" + cmd.Name + " - " + tr(lang, "cmd_"+cmd.Name) + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// RegisterCommands publishes the public command list to Telegram with setMyCommands,
+// once for each supported language and once as the default list
+func RegisterCommands(bot *tgbotapi.BotAPI) {
+	for _, lang := range []string{"", LangID, LangEN} {
+		catalogLang := lang
+		if catalogLang == "" {
+			catalogLang = defaultLanguage
+		}
+
+		var botCommands []tgbotapi.BotCommand
+		for _, cmd := range commands {
+			if cmd.AdminOnly {
+				continue
+			}
+			botCommands = append(botCommands, tgbotapi.BotCommand{
+				Command:     cmd.Name,
+				Description: tr(catalogLang, "cmd_"+cmd.Name),
+			})
+		}
+
+		config := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), lang, botCommands...)
+		if _, err := bot.Request(config); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":    err,
+				"language": lang,
+			}).Error("Failed to register bot commands")
+		}
+	}
+}
+
+// runStart greets the user. A deep-link payload (t.me/bot?start=python_hacking) is searched right away.
+func runStart(ctx *messageContext) {
+	if ctx.Args == "" {
+		ctx.reply(tr(ctx.Lang, "start"))
+		return
+	}
+	query := strings.NewReplacer("_", " ", "-", " ").Replace(ctx.Args)
+	handleProductSearch(ctx, query)
+}
+
+// runHelp shows the general help, or the detailed help of the command given as argument
+func runHelp(ctx *messageContext) {
+	if ctx.Args == "" {
+		ctx.reply(tr(ctx.Lang, "help", commandList(ctx.Lang)))
+		return
+	}
+
+	cmd, found := findCommand(strings.TrimPrefix(strings.Fields(ctx.Args)[0], "/"))
+	if !found || (cmd.AdminOnly && !isAdmin(ctx.Update.Message.From.ID)) {
+		ctx.reply(tr(ctx.Lang, "unknown_command", ctx.Args))
+		return
+	}
+	ctx.reply(tr(ctx.Lang, "cmd_"+cmd.Name+"_help"))
+}
+
+// runCategories shows the categories of the catalog
+func runCategories(ctx *messageContext) {
+	handleCategories(ctx)
+}
+
+// runStore sets the preferred store of the user
+func runStore(ctx *messageContext) {
+	handleStore(ctx)
+}
+
+// runReview sends the review link of the given title, or asks for the title
+func runReview(ctx *messageContext) {
+	if ctx.Args == "" {
+		startConversation(ctx.ChatID(), ctx.UserID(), flowReview, stepTitle)
+		ctx.reply(tr(ctx.Lang, "review_ask_title"))
+		return
+	}
+	handleReviewLink(ctx, ctx.Args)
+}
+
+// runSubmitReview starts the /beriulasan flow
+func runSubmitReview(ctx *messageContext) {
+	handleSubmitReview(ctx, ctx.Args)
+}
+
+// runLanguage switches the bot language of the user, or asks for the language
+func runLanguage(ctx *messageContext) {
+	if ctx.Args == "" {
+		startConversation(ctx.ChatID(), ctx.UserID(), flowLanguage, stepLanguage)
+		usage := tr(ctx.Lang, "language_usage")
+		if ctx.Group != nil {
+			usage += "\n" + tr(ctx.Lang, "language_group_usage")
+		}
+		ctx.reply(usage)
+		return
+	}
+	handleLanguage(ctx, ctx.Args)
+}
+
+// runCancel ends the current conversation
+func runCancel(ctx *messageContext) {
+	handleCancel(ctx)
+}
+
+// runGroupSettings shows the settings of the group
+func runGroupSettings(ctx *messageContext) {
+	handleGroupSettings(ctx)
+}
+
+// runDataExport sends the user their stored data
+func runDataExport(ctx *messageContext) {
+	handleDataExport(ctx)
+}
+
+// runDataDeletion erases the stored data of the user after confirmation
+func runDataDeletion(ctx *messageContext) {
+	handleDataDeletion(ctx)
+}
+
+// runModeration lists the reviews waiting for moderation
+func runModeration(ctx *messageContext) {
+	handleModerationList(ctx)
+}
+
+// runUnsubscribe stops the broadcasts to the user
+func runUnsubscribe(ctx *messageContext) {
+	handleSubscription(ctx, true)
+}
+
+// runSubscribe resumes the broadcasts to the user
+func runSubscribe(ctx *messageContext) {
+	handleSubscription(ctx, false)
+}
+
+// runBroadcast previews a broadcast to the users, or lists the latest broadcasts
+func runBroadcast(ctx *messageContext) {
+	handleBroadcast(ctx)
+}
+
+// runAddBook adds a book to the catalog
+func runAddBook(ctx *messageContext) {
+	handleAddBook(ctx)
+}
+
+// runEditBook renames a book or changes its category
+func runEditBook(ctx *messageContext) {
+	handleEditBook(ctx)
+}
+
+// runDeleteBook removes a book from the catalog
+func runDeleteBook(ctx *messageContext) {
+	handleDeleteBook(ctx)
+}
+
+// runAddLink adds store links to a book
+func runAddLink(ctx *messageContext) {
+	handleAddLink(ctx)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	"github.com/sirupsen/logrus"
+)
+
+// conversationTimeout is how long a conversation waits for the user's next message before it is dropped
+const conversationTimeout = 10 * time.Minute
+
+// Multi-step flows a conversation can be in
+const (
+	flowReview       = "review"
+	flowLanguage     = "language"
+	flowSubmitReview = "submit_review"
+)
+
+// Steps of the flows, each naming what the bot is waiting for
+const (
+	stepTitle    = "title"
+	stepLanguage = "language"
+	stepRating   = "rating"
+	stepText     = "text"
+)
+
+// conversationFlow continues a multi-step command with the user's next message
+type conversationFlow func(ctx *messageContext, conversation *datauser.Conversation)
+
+// conversationFlows maps each flow to its handler
+var conversationFlows map[string]conversationFlow
+
+func init() {
+	conversationFlows = map[string]conversationFlow{
+		flowReview:       continueReviewLookup,
+		flowLanguage:     continueLanguage,
+		flowSubmitReview: continueSubmitReview,
+	}
+}
+
+// getConversation returns the conversation the user is in within the chat, dropping it if it timed out.
+// In groups each member has their own conversation.
+func getConversation(chatID, userID int64) (*datauser.Conversation, bool) {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return nil, false
+	}
+	conversation, found, _ := findConversation(db, chatID, userID)
+	return conversation, found
+}
+
+// findConversation returns the conversation the user is in within the chat from loaded user data.
+// A conversation that timed out is dropped and reported as expired.
+func findConversation(db *datauser.Database, chatID, userID int64) (*datauser.Conversation, bool, bool) {
+	chat, found := db.FindChat(chatID)
+	if !found {
+		return nil, false, false
+	}
+	conversation := chat.ConversationOf(userID)
+	if conversation == nil {
+		return nil, false, false
+	}
+	if time.Since(conversation.UpdatedAt) > conversationTimeout {
+		clearConversation(chatID, userID)
+		return nil, false, true
+	}
+	return conversation, true, false
+}
+
+// startConversation puts the user in the first step of a flow
+func startConversation(chatID, userID int64, flow, step string) {
+	setConversation(chatID, userID, &datauser.Conversation{Flow: flow, Step: step})
+}
+
+// setConversation stores the conversation state of the user and restarts its timeout
+func setConversation(chatID, userID int64, conversation *datauser.Conversation) {
+	conversation.UpdatedAt = time.Now()
+	updateChatRecord(chatID, func(chat *datauser.ChatData) {
+		chat.SetConversationOf(userID, conversation)
+	})
+}
+
+// clearConversation ends the conversation of the user
+func clearConversation(chatID, userID int64) {
+	updateChatRecord(chatID, func(chat *datauser.ChatData) {
+		chat.SetConversationOf(userID, nil)
+	})
+}
+
+// continueConversation hands the user's message to the flow the chat is in
+func continueConversation(ctx *messageContext, conversation *datauser.Conversation) {
+	flow, found := conversationFlows[conversation.Flow]
+	if !found {
+		clearConversation(ctx.ChatID(), ctx.UserID())
+		handleProductSearch(ctx, ctx.Update.Message.Text)
+		return
+	}
+	flow(ctx, conversation)
+}
+
+// handleCancel ends the current conversation on /batal.
+// The conversation itself is already cleared when the command arrives.
+func handleCancel(ctx *messageContext) {
+	if ctx.InConversation {
+		ctx.reply(tr(ctx.Lang, "cancelled"))
+	} else {
+		ctx.reply(tr(ctx.Lang, "nothing_to_cancel"))
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// dashboardEventBuffer is the number of events kept for a dashboard that is slow to read them.
+// Events beyond it are dropped for that dashboard.
+const dashboardEventBuffer = 100
+
+// dashboardCheckInterval is how often an open dashboard checks whether its counters must be refreshed
+const dashboardCheckInterval = 2 * time.Second
+
+// dashboardRefreshInterval is the longest time between two counter updates, which also keeps idle connections open
+// and rolls the counters over at midnight
+const dashboardRefreshInterval = 30 * time.Second
+
+// Types of the server-sent events of the dashboard
+const (
+	dashboardStatsEvent   = "stats"
+	dashboardMessageEvent = "message"
+)
+
+// DashboardStats are the live counters of the dashboard, counted since midnight
+type DashboardStats struct {
+	MessagesToday      int       `json:"messages_today"`
+	RepliesToday       int       `json:"replies_today"`
+	AdminMessagesToday int       `json:"admin_messages_today"`
+	ActiveUsers        int       `json:"active_users"`
+	ZeroResultSearches int       `json:"zero_result_searches"`
+	Searches           int       `json:"searches"`
+	Users              int       `json:"users"`
+	Chats              int       `json:"chats"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// DashboardMessage is a message of the live feed: an incoming message or a bot reply, with who it is from
+type DashboardMessage struct {
+	ChatID    int64  `json:"chat_id"`
+	ChatType  string `json:"chat_type,omitempty"`
+	ChatTitle string `json:"chat_title,omitempty"`
+	Name      string `json:"name,omitempty"`
+	datauser.Message
+}
+
+// dashboardEvent is a server-sent event for the open dashboards
+type dashboardEvent struct {
+	Type string
+	Data interface{}
+}
+
+// eventHub fans the dashboard events out to the open dashboards
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan dashboardEvent]bool
+	// version changes with every published message, so dashboards know their counters are stale
+	version int
+}
+
+// dashboardEvents is the hub the message handlers publish to
+var dashboardEvents = &eventHub{subscribers: make(map[chan dashboardEvent]bool)}
+
+// statsCache shares the dashboard counters between the open dashboards, so they are computed at most once per
+// dashboardCheckInterval however many dashboards are open
+type statsCache struct {
+	mu      sync.Mutex
+	valid   bool
+	version int
+	at      time.Time
+	stats   DashboardStats
+}
+
+// dashboardStatsCache holds the last counters computed for the dashboards
+var dashboardStatsCache = &statsCache{}
+
+// get returns the counters for the given hub version and the version they were computed at. Counters are
+// recomputed when they are stale, unless they were computed less than dashboardCheckInterval ago.
+func (c *statsCache) get(version int, now time.Time) (DashboardStats, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := now.Sub(c.at)
+	if c.valid && (age < dashboardCheckInterval || (c.version == version && age < dashboardRefreshInterval)) {
+		return c.stats, c.version, nil
+	}
+	stats, err := dashboardStats(now)
+	if err != nil {
+		return stats, version, err
+	}
+	c.valid, c.version, c.at, c.stats = true, version, now, stats
+	return stats, version, nil
+}
+
+// subscribe registers an open dashboard and returns the channel its events are sent to
+func (h *eventHub) subscribe() chan dashboardEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make(chan dashboardEvent, dashboardEventBuffer)
+	h.subscribers[events] = true
+	return events
+}
+
+// unsubscribe forgets a closed dashboard
+func (h *eventHub) unsubscribe(events chan dashboardEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, events)
+}
+
+// publish sends an event to every open dashboard without waiting for slow ones
+func (h *eventHub) publish(event dashboardEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version++
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			logrus.Debug("Dropping dashboard event for a slow client")
+		}
+	}
+}
+
+// currentVersion returns the number of events published so far
+func (h *eventHub) currentVersion() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.version
+}
+
+// publishDashboardMessage shows a message stored in the history of a chat in the live feed of the dashboards
+func publishDashboardMessage(db *datauser.Database, chatID int64, message datauser.Message) {
+	event := DashboardMessage{ChatID: chatID, Message: message}
+	if chat, found := db.FindChat(chatID); found {
+		event.ChatType = chat.Type
+		event.ChatTitle = chat.Title
+	}
+	if user, found := db.FindUser(message.UserID); found {
+		event.Name = user.Username
+		if event.Name == "" {
+			event.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		}
+	}
+	dashboardEvents.publish(dashboardEvent{Type: dashboardMessageEvent, Data: event})
+}
+
+// dashboardStats counts the activity of the day from the user data and the search events
+func dashboardStats(now time.Time) (DashboardStats, error) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	stats := DashboardStats{UpdatedAt: now}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		return stats, err
+	}
+	stats.Users = len(db.Users)
+	stats.Chats = len(db.Chats)
+	active := make(map[int64]bool)
+	for _, chat := range db.Chats {
+		for _, message := range chat.Messages {
+			if message.Timestamp.Before(midnight) {
+				continue
+			}
+			switch message.Sender {
+			case "bot":
+				stats.RepliesToday++
+				continue
+			case "admin":
+				stats.AdminMessagesToday++
+				continue
+			}
+			stats.MessagesToday++
+			if message.UserID != 0 {
+				active[message.UserID] = true
+			}
+		}
+	}
+	stats.ActiveUsers = len(active)
+
+	searchEventsMu.Lock()
+	events, err := loadSearchEvents(searchEventsFile)
+	searchEventsMu.Unlock()
+	if err != nil {
+		return stats, err
+	}
+	for _, event := range events {
+		if event.Timestamp.Before(midnight) {
+			continue
+		}
+		stats.Searches++
+		if event.Results == 0 {
+			stats.ZeroResultSearches++
+		}
+	}
+	return stats, nil
+}
+
+// writeDashboardEvent writes a server-sent event and flushes it to the dashboard
+func writeDashboardEvent(w *bufio.Writer, event dashboardEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Dashboard registers the live admin dashboard, its event stream and the user data page rendered to user_data.html,
+// protected by ADMIN_TOKEN or a /login session
+func Dashboard(app *fiber.App) {
+	app.Get("/html", requireAdminPage, func(c *fiber.Ctx) error {
+		return c.SendFile(userDataHTMLFile)
+	})
+	app.Get("/dashboard", requireAdminPage, func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(datauser.DashboardPage)
+	})
+	app.Get("/dashboard/events", requireAdminToken, handleDashboardEvents)
+}
+
+// handleDashboardEvents streams the dashboard events: the counters when they change, then every message
+// stored by the bot as it happens. The stream ends when the dashboard is closed.
+func handleDashboardEvents(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	events := dashboardEvents.subscribe()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer dashboardEvents.unsubscribe(events)
+
+		ticker := time.NewTicker(dashboardCheckInterval)
+		defer ticker.Stop()
+
+		// Versi -1 memaksa penghitung dikirim saat dashboard dibuka
+		sentVersion := -1
+		var sentAt time.Time
+		refresh := true
+		for {
+			// Penghitung hanya dihitung ulang sekali per interval, tidak untuk setiap pesan
+			if version := dashboardEvents.currentVersion(); refresh && (version != sentVersion || time.Since(sentAt) >= dashboardRefreshInterval) {
+				// Penghitung dibagi antar dashboard; versinya bisa lebih lama dan akan disegarkan di interval berikutnya
+				stats, statsVersion, err := dashboardStatsCache.get(version, time.Now())
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"error": err,
+					}).Error("Failed to compute dashboard stats")
+					// Tetap tulis komentar agar dashboard yang sudah ditutup terdeteksi
+					if _, err := w.WriteString(": ping\n\n"); err != nil || w.Flush() != nil {
+						return
+					}
+				} else if err := writeDashboardEvent(w, dashboardEvent{Type: dashboardStatsEvent, Data: stats}); err != nil {
+					return
+				}
+				sentVersion, sentAt = statsVersion, time.Now()
+			}
+
+			refresh = false
+			select {
+			case event := <-events:
+				if err := writeDashboardEvent(w, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				refresh = true
+			}
+		}
+	})
+	return nil
+}
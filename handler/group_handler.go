@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// groupSettingsFile is the JSON file holding the settings of each group
+const groupSettingsFile = "group_settings.json"
+
+// defaultGroupMaxResults is the number of books listed in a group when the admins didn't choose one
+const defaultGroupMaxResults = 5
+
+// groupMaxResultsChoices are the result limits group admins can pick from
+var groupMaxResultsChoices = []int{3, 5, 10}
+
+// GroupSettings holds the behaviour of the bot in a group, configured by the group admins
+type GroupSettings struct {
+	ChatID     int64  `json:"chat_id"`
+	Title      string `json:"title"`
+	SearchAll  bool   `json:"search_all"`
+	MaxResults int    `json:"max_results"`
+}
+
+// groupSettingsMu serializes read-modify-write cycles on the group settings file
+var groupSettingsMu sync.Mutex
+
+// loadGroupSettings loads the settings of all groups from a JSON file
+func loadGroupSettings(filename string) ([]GroupSettings, error) {
+	var settings []GroupSettings
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// saveGroupSettings saves the settings of all groups to a JSON file
+func saveGroupSettings(filename string, settings []GroupSettings) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// getGroupSettings returns the settings of a group, or the defaults if the admins never changed them
+func getGroupSettings(chat *tgbotapi.Chat) GroupSettings {
+	groupSettingsMu.Lock()
+	all, err := loadGroupSettings(groupSettingsFile)
+	groupSettingsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load group settings")
+	}
+
+	for _, settings := range all {
+		if settings.ChatID == chat.ID {
+			return settings
+		}
+	}
+	return GroupSettings{ChatID: chat.ID, Title: chat.Title, MaxResults: defaultGroupMaxResults}
+}
+
+// updateGroupSettings stores the settings of a group
+func updateGroupSettings(settings GroupSettings) error {
+	groupSettingsMu.Lock()
+	defer groupSettingsMu.Unlock()
+
+	all, err := loadGroupSettings(groupSettingsFile)
+	if err != nil {
+		return err
+	}
+
+	for i := range all {
+		if all[i].ChatID == settings.ChatID {
+			all[i] = settings
+			return saveGroupSettings(groupSettingsFile, all)
+		}
+	}
+	all = append(all, settings)
+	return saveGroupSettings(groupSettingsFile, all)
+}
+
+// isGroupChat reports whether the message was sent in a group or supergroup
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat.IsGroup() || chat.IsSuperGroup()
+}
+
+// addressedToBot reports whether a group message is meant for the bot:
+// a message explicitly addressed to it, or any message if the group searches everything
+func addressedToBot(message *tgbotapi.Message, bot *tgbotapi.BotAPI, settings GroupSettings) bool {
+	return settings.SearchAll || explicitlyAddressed(message, bot)
+}
+
+// explicitlyAddressed reports whether a group message is a command, a mention of the bot or a reply to one of its messages
+func explicitlyAddressed(message *tgbotapi.Message, bot *tgbotapi.BotAPI) bool {
+	if message.IsCommand() {
+		return true
+	}
+	if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil && message.ReplyToMessage.From.ID == bot.Self.ID {
+		return true
+	}
+	return mentionsBot(message, bot.Self.UserName)
+}
+
+// mentionsBot reports whether the message contains an @mention of the bot
+func mentionsBot(message *tgbotapi.Message, botUsername string) bool {
+	for _, entity := range message.Entities {
+		if !entity.IsMention() {
+			continue
+		}
+		mention := entityText(message.Text, entity)
+		if strings.EqualFold(strings.TrimPrefix(mention, "@"), botUsername) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityText returns the part of text covered by a message entity. Entity offsets count UTF-16 code units.
+func entityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// stripBotMention removes the @mention of the bot from a message so the rest can be searched
+func stripBotMention(text, botUsername string) string {
+	if botUsername == "" {
+		return text
+	}
+	fields := strings.Fields(text)
+	kept := fields[:0]
+	for _, field := range fields {
+		if !strings.EqualFold(field, "@"+botUsername) {
+			kept = append(kept, field)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// isGroupAdmin reports whether the user administers the group, bot admins always count as group admins
+func isGroupAdmin(bot *tgbotapi.BotAPI, chatID, userID int64) bool {
+	if isAdmin(userID) {
+		return true
+	}
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":        err,
+			"chat_id_hash": hashID(chatID),
+		}).Error("Failed to get chat member")
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// handleCompactSearch answers a search in a group with a single message listing the first results
+func handleCompactSearch(ctx *messageContext, query string) {
+	matchingProducts, view, ok := searchWithStoreFilter(ctx, query)
+	if !ok {
+		return
+	}
+	if len(matchingProducts) == 0 {
+		// Saat semua pesan dianggap pencarian, jangan banjiri grup dengan "tidak ditemukan"
+		if !ctx.Group.SearchAll {
+			ctx.reply(tr(ctx.Lang, "product_missing"))
+		}
+		return
+	}
+
+	maxResults := ctx.Group.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultGroupMaxResults
+	}
+
+	var b strings.Builder
+	shown := 0
+	for _, product := range matchingProducts {
+		if shown == maxResults {
+			break
+		}
+		shown++
+		ctx.Results = append(ctx.Results, product.Nama)
+
+		var links []string
+		for _, link := range trackedLinks(product, productLinks(product, view), ctx.Update.Message.From.ID) {
+			links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link.URL), html.EscapeString(link.Store)))
+		}
+		if product.ReviewLink != "" {
+			links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(product.ReviewLink), html.EscapeString(tr(ctx.Lang, "review_button"))))
+		}
+		b.WriteString(fmt.Sprintf("%d. <b>%s</b>\n%s\n", shown, html.EscapeString(product.Nama), strings.Join(links, " · ")))
+	}
+
+	if remaining := len(matchingProducts) - shown; remaining > 0 {
+		searched, _ := parseStoreFilter(query)
+		deepLink := "https://t.me/" + ctx.Bot.Self.UserName + "?start=" + url.QueryEscape(deepLinkPayload(searched))
+		b.WriteString("\n" + tr(ctx.Lang, "group_more_results", remaining, html.EscapeString(deepLink)))
+	}
+
+	ctx.reply(strings.TrimSpace(b.String()))
+	ctx.Msg.ParseMode = tgbotapi.ModeHTML
+	ctx.Msg.DisableWebPagePreview = true
+}
+
+// deepLinkPayload turns a search query into a /start payload, which only allows letters, digits, _ and -
+func deepLinkPayload(query string) string {
+	payload := strings.ReplaceAll(normalizeText(query), " ", "_")
+	var b strings.Builder
+	for _, r := range payload {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() > 64 {
+		return b.String()[:64]
+	}
+	return b.String()
+}
+
+// groupSettingsMessage renders the settings of a group with buttons to change them
+func groupSettingsMessage(settings GroupSettings, lang string) (string, tgbotapi.InlineKeyboardMarkup) {
+	searchAll := tr(lang, "setting_off")
+	toggle := "on"
+	if settings.SearchAll {
+		searchAll = tr(lang, "setting_on")
+		toggle = "off"
+	}
+	text := tr(lang, "group_settings", searchAll, settings.MaxResults)
+
+	var maxButtons []tgbotapi.InlineKeyboardButton
+	for _, choice := range groupMaxResultsChoices {
+		label := strconv.Itoa(choice)
+		if choice == settings.MaxResults {
+			label = "✅ " + label
+		}
+		maxButtons = append(maxButtons, tgbotapi.NewInlineKeyboardButtonData(label, callbackGroup+"max:"+strconv.Itoa(choice)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "group_toggle_search_all"), callbackGroup+"search_all:"+toggle)),
+		maxButtons,
+	)
+	return text, keyboard
+}
+
+// handleGroupSettings shows the group settings to a group admin on /pengaturan
+func handleGroupSettings(ctx *messageContext) {
+	if ctx.Group == nil {
+		ctx.reply(tr(ctx.Lang, "group_only"))
+		return
+	}
+	if !isGroupAdmin(ctx.Bot.BotAPI, ctx.ChatID(), ctx.Update.Message.From.ID) {
+		ctx.reply(tr(ctx.Lang, "group_admin_only"))
+		return
+	}
+
+	text, keyboard := groupSettingsMessage(*ctx.Group, ctx.Lang)
+	ctx.reply(text)
+	ctx.Msg.ReplyMarkup = keyboard
+}
+
+// handleGroupCallback applies a change made with the buttons of the group settings message
+func handleGroupCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, lang string, msg *tgbotapi.MessageConfig) {
+	chat := query.Message.Chat
+	if !isGroupChat(chat) {
+		return
+	}
+	if !isGroupAdmin(bot.BotAPI, chat.ID, query.From.ID) {
+		msg.Text = tr(lang, "group_admin_only")
+		return
+	}
+
+	settings := getGroupSettings(chat)
+	settings.Title = chat.Title
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+	switch parts[0] {
+	case "search_all":
+		settings.SearchAll = parts[1] == "on"
+	case "max":
+		maxResults, err := strconv.Atoi(parts[1])
+		if err != nil || maxResults <= 0 {
+			return
+		}
+		settings.MaxResults = maxResults
+	default:
+		return
+	}
+
+	if err := updateGroupSettings(settings); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":        err,
+			"chat_id_hash": hashID(chat.ID),
+		}).Error("Failed to save group settings")
+		return
+	}
+
+	text, keyboard := groupSettingsMessage(settings, lang)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chat.ID, query.Message.MessageID, text, keyboard)
+	if _, err := bot.Send(edit); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to update group settings message")
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultHandoffTimeoutMinutes is how long bot replies stay paused after the last admin action when
+// HANDOFF_TIMEOUT_MINUTES is not set
+const defaultHandoffTimeoutMinutes = 60
+
+// maxAdminMessageLength is the longest text Telegram accepts in a message
+const maxAdminMessageLength = 4096
+
+// HandoffState tells whether the bot replies to a user are paused while an admin handles the conversation
+type HandoffState struct {
+	Paused    bool       `json:"paused"`
+	Since     *time.Time `json:"since,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// adminMessageRequest is the body of POST /api/admin/users/:id/messages
+type adminMessageRequest struct {
+	Text string `json:"text"`
+}
+
+// handoffRequest is the body of PUT /api/admin/users/:id/handoff
+type handoffRequest struct {
+	Paused bool `json:"paused"`
+}
+
+// handoffTimeout returns how long a handoff lasts after the last admin action, set in minutes with
+// HANDOFF_TIMEOUT_MINUTES. 0 keeps the bot paused until an admin resumes it.
+func handoffTimeout() time.Duration {
+	return time.Duration(envInt("HANDOFF_TIMEOUT_MINUTES", defaultHandoffTimeoutMinutes)) * time.Minute
+}
+
+// handoffState describes the handoff of a chat at now
+func handoffState(chat *datauser.ChatData, now time.Time) HandoffState {
+	timeout := handoffTimeout()
+	if chat == nil || !chat.HandedOff(now, timeout) {
+		return HandoffState{}
+	}
+	state := HandoffState{Paused: true, Since: &chat.Handoff.Since}
+	if timeout > 0 {
+		expiresAt := chat.Handoff.UpdatedAt.Add(timeout)
+		state.ExpiresAt = &expiresAt
+	}
+	return state
+}
+
+// chatHandedOff reports whether an admin is handling the chat, so the bot must not answer it
+func chatHandedOff(db *datauser.Database, chatID int64) bool {
+	chat, found := db.FindChat(chatID)
+	return found && chat.HandedOff(time.Now(), handoffTimeout())
+}
+
+// updateHandoff pauses or resumes the bot replies in the private chat of a user and returns the new state.
+// touch only refreshes a running handoff, as done when an admin sends a message.
+func updateHandoff(userID int64, paused, touch bool) (HandoffState, error) {
+	userDataMu.Lock()
+	defer userDataMu.Unlock()
+
+	db, err := datauser.LoadDatabase(userDataFile)
+	if err != nil {
+		return HandoffState{}, err
+	}
+
+	now := time.Now()
+	chat := db.UpsertChat(userID)
+	if chat.Type == "" {
+		chat.Type = datauser.ChatPrivate
+	}
+	active := chat.HandedOff(now, handoffTimeout())
+	switch {
+	case touch && active:
+		chat.Handoff.UpdatedAt = now
+	case touch:
+		return handoffState(chat, now), nil
+	case paused && active:
+		chat.Handoff.UpdatedAt = now
+	case paused:
+		chat.Handoff = &datauser.Handoff{Since: now, UpdatedAt: now}
+	default:
+		chat.Handoff = nil
+	}
+
+	if err := datauser.SaveDatabase(userDataFile, db); err != nil {
+		return HandoffState{}, err
+	}
+	return handoffState(chat, now), nil
+}
+
+// handleSendAdminMessage sends a message from an admin to a user through the bot and stores it in the
+// private chat of the user with the "admin" sender. It also extends a running handoff.
+func handleSendAdminMessage(c *fiber.Ctx, bot *tgbotapi.BotAPI) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user id must be a number"})
+	}
+	var request adminMessageRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	text := strings.TrimSpace(request.Text)
+	if text == "" || len([]rune(text)) > maxAdminMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "text must be between 1 and " + strconv.Itoa(maxAdminMessageLength) + " characters"})
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if _, found := db.FindUser(userID); !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+
+	// Pesan admin selalu dikirim ke chat pribadi pengguna
+	out := newSender(bot, userID)
+	if _, err := out.Send(tgbotapi.NewMessage(userID, text)); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"user_id_hash": hashID(userID),
+			"error":        err,
+		}).Error("Failed to send admin message")
+		if apiErr, ok := err.(*tgbotapi.Error); ok && apiErr.Code == 403 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "the user blocked the bot or never started a private chat with it"})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to send the message through Telegram"})
+	}
+	for i := range out.sent {
+		out.sent[i].Message.Sender = "admin"
+	}
+	saveBotMessages(out.sent)
+
+	state, err := updateHandoff(userID, false, true)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"user_id_hash": hashID(userID),
+			"error":        err,
+		}).Error("Failed to extend handoff")
+	}
+	logrus.WithFields(logrus.Fields{
+		"user_id_hash": hashID(userID),
+		"handoff":      state.Paused,
+	}).Info("Admin message sent")
+
+	response := fiber.Map{"handoff": state}
+	if len(out.sent) > 0 {
+		response["message"] = datauser.ChatMessage{ChatID: userID, Message: out.sent[0].Message}
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// handleSetHandoff pauses or resumes the automatic bot replies to a user, e.g. PUT {"paused": true}
+func handleSetHandoff(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user id must be a number"})
+	}
+	var request handoffRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if _, found := db.FindUser(userID); !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+
+	state, err := updateHandoff(userID, request.Paused, false)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to update handoff")
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	logrus.WithFields(logrus.Fields{
+		"user_id_hash": hashID(userID),
+		"paused":       state.Paused,
+	}).Info("Handoff updated")
+	return c.JSON(state)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gofiber/fiber/v2"
+)
+
+// readyTimeout bounds each Telegram call made by the readiness check
+const readyTimeout = 5 * time.Second
+
+// startedAt is when the process started, reported by /healthz
+var startedAt = time.Now()
+
+// readyCheck is the outcome of one readiness check
+type readyCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Health registers /healthz, which only tells the process is alive, and /readyz, which checks the
+// catalog, storage, Telegram API and webhook and answers 503 if any check fails
+func Health(app *fiber.App, bot *tgbotapi.BotAPI, catalog *Catalog) {
+	app.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status":         "ok",
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		})
+	})
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		return handleReady(c, bot, catalog.Products())
+	})
+}
+
+func handleReady(c *fiber.Ctx, bot *tgbotapi.BotAPI, products []Product) error {
+	checks := []readyCheck{
+		runReadyCheck("catalog", func() (string, error) { return checkCatalog(products) }),
+		runReadyCheck("storage", checkStorage),
+		runReadyCheck("telegram", func() (string, error) { return checkTelegram(bot) }),
+		runReadyCheck("webhook", func() (string, error) { return checkWebhook(bot) }),
+	}
+
+	status, code := "ready", fiber.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "not_ready", fiber.StatusServiceUnavailable
+			break
+		}
+	}
+	return c.Status(code).JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+// runReadyCheck runs a check and times it
+func runReadyCheck(name string, check func() (string, error)) readyCheck {
+	start := time.Now()
+	detail, err := check()
+	result := readyCheck{Name: name, OK: err == nil, Detail: detail, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// checkCatalog fails when no product was loaded
+func checkCatalog(products []Product) (string, error) {
+	if len(products) == 0 {
+		return "", fmt.Errorf("no products loaded")
+	}
+	return fmt.Sprintf("%d products", len(products)), nil
+}
+
+// checkStorage fails when the data files can't be written in the working directory
+func checkStorage() (string, error) {
+	file, err := os.CreateTemp(".", ".readyz-*")
+	if err != nil {
+		return "", err
+	}
+	name := file.Name()
+	_, err = file.WriteString("ok")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return "working directory writable", nil
+}
+
+// checkTelegram fails when getMe doesn't answer within readyTimeout
+func checkTelegram(bot *tgbotapi.BotAPI) (string, error) {
+	var me tgbotapi.User
+	err := withReadyTimeout("getMe", func() error {
+		var err error
+		me, err = bot.GetMe()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return "@" + me.UserName, nil
+}
+
+// checkWebhook fails when no webhook is set, or when it differs from WEBHOOK_URL
+func checkWebhook(bot *tgbotapi.BotAPI) (string, error) {
+	var info tgbotapi.WebhookInfo
+	err := withReadyTimeout("getWebhookInfo", func() error {
+		var err error
+		info, err = bot.GetWebhookInfo()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsSet() {
+		return "", fmt.Errorf("webhook is not set")
+	}
+	if expected := os.Getenv("WEBHOOK_URL"); expected != "" && info.URL != expected {
+		return "", fmt.Errorf("webhook is set to another URL")
+	}
+	if info.LastErrorMessage != "" {
+		return fmt.Sprintf("%d pending updates, last error: %s", info.PendingUpdateCount, info.LastErrorMessage), nil
+	}
+	return fmt.Sprintf("%d pending updates", info.PendingUpdateCount), nil
+}
+
+// withReadyTimeout runs a Telegram call, giving up after readyTimeout
+func withReadyTimeout(method string, call func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			return nil
+		}
+		// Jangan tampilkan URL permintaan, karena berisi token bot
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s failed: %v", method, err)
+	case <-time.After(readyTimeout):
+		return fmt.Errorf("%s timed out after %s", method, readyTimeout)
+	}
+}
@@ -0,0 +1,392 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Supported bot languages
+const (
+	LangID = "id"
+	LangEN = "en"
+)
+
+// defaultLanguage is used when a user's language can't be determined
+const defaultLanguage = LangID
+
+// languageAuto is the /bahasa argument that clears a chosen language, so replies follow the Telegram app again
+const languageAuto = "auto"
+
+// languageGroup starts the /bahasa arguments setting the default language of a group, as in "/bahasa grup en"
+const languageGroup = "grup"
+
+// messages is the catalog of every text the bot sends, keyed by language then message key
+var messages = map[string]map[string]string{
+	LangID: {
+		"start": "📚 Selamat datang di BookFinderBot! Saya adalah bot pencari Ebook & Buku. Cari Ebook apa yang Anda butuhkan? Ketikkan judul atau topik yang Anda inginkan, dan saya akan mencarikannya untuk Anda.",
+		"help": `ℹ️ Gunakan bot ini untuk mencari Ebook & Buku. Anda cukup ketik judul atau topik yang ingin Anda cari, dan saya akan mencarikannya untuk Anda.
+
+🔍 Contoh penggunaan:
+Ketikkan "Belajar Python" untuk mencari Ebook atau Buku tentang pemrograman Python.
+Ketikkan "Hacking" untuk mencari Ebook atau Buku tentang hacking.
+Ketikkan "python toko:gramedia" untuk hanya menampilkan link dari Gramedia.
+
+📖 Anda juga bisa menggunakan perintah:
+%s
+
+Ketik /help [perintah] untuk bantuan lengkap sebuah perintah, misalnya /help ulasan.
+
+💡 Tips: Judul tidak harus lengkap dan huruf besar/kecil tidak berpengaruh. Jika ada beberapa buku yang cocok, pilih salah satunya dari tombol yang muncul.
+
+📘 Contoh penggunaan:
+/ulasan Ilmu Hacking
+untuk mendapatkan link ulasan buku Ilmu Hacking.
+
+📝 Catatan:
+Kamu juga bisa memberikan ulasan langsung di sini dengan perintah /beriulasan.`,
+		"review_found":             "📘 Link ulasan untuk %s:\n%s",
+		"review_not_found":         "⚠️ Link ulasan untuk %s tidak ditemukan.\nKamu bisa memberikan ulasan dengan perintah /beriulasan.",
+		"review_choose":            "🔎 Ada beberapa buku yang cocok dengan \"%s\". Pilih buku yang ulasannya ingin kamu lihat:",
+		"product_title":            "📖 Judul: %s",
+		"review_button":            "📘 Baca ulasan",
+		"product_missing":          "⚠️ Produk tidak ditemukan.",
+		"language_usage":           "🌐 Bahasa saat ini: Indonesia.\nKetik id untuk Bahasa Indonesia, en untuk English, atau auto agar bahasa mengikuti aplikasi Telegram.",
+		"language_group_usage":     "Admin grup bisa mengatur bahasa bawaan grup dengan /bahasa grup id, en, atau auto.",
+		"language_invalid":         "⚠️ Bahasa %s tidak didukung. Pilihan yang tersedia: id, en, auto.",
+		"language_set":             "✅ Bahasa diganti ke Bahasa Indonesia.",
+		"language_set_group":       "✅ Bahasa bawaan grup diganti ke Bahasa Indonesia. Anggota yang memilih bahasa sendiri dengan /bahasa tetap memakai pilihannya.",
+		"language_auto":            "✅ Bahasa kembali mengikuti aplikasi Telegram.",
+		"language_auto_group":      "✅ Grup tidak lagi punya bahasa bawaan. Setiap anggota dibalas dengan bahasa pilihannya atau bahasa aplikasi Telegram-nya.",
+		"product_rating":           "⭐ %s/5 (%d ulasan)",
+		"submit_ask_title":         "✍️ Buku apa yang ingin kamu ulas? Ketikkan judulnya.",
+		"submit_not_found":         "⚠️ Buku %s tidak ditemukan. Coba ketikkan judul yang lain.",
+		"submit_choose":            "🔎 Ada beberapa buku yang cocok dengan \"%s\". Pilih buku yang ingin kamu ulas:",
+		"submit_ask_rating":        "⭐ Berapa bintang untuk %s? Pilih 1 sampai 5.",
+		"submit_ask_text":          "📝 Kamu memberi %d bintang. Sekarang tuliskan ulasanmu.",
+		"submit_text_required":     "📝 Ulasan harus berupa teks. Tuliskan ulasanmu, atau ketik /batal.",
+		"submit_thanks":            "🙏 Terima kasih! Ulasanmu akan dipublikasikan setelah diperiksa oleh admin.",
+		"submit_failed":            "⚠️ Maaf, ulasanmu gagal disimpan. Silakan coba lagi nanti.",
+		"submit_approved":          "✅ Ulasanmu untuk %s sudah dipublikasikan. Terima kasih!",
+		"submit_rejected":          "❌ Maaf, ulasanmu untuk %s tidak disetujui oleh admin.",
+		"review_ask_title":         "📘 Buku apa yang ingin kamu lihat ulasannya? Ketikkan judulnya.",
+		"cancel_hint":              "Ketik /batal untuk membatalkan.",
+		"cancelled":                "✅ Dibatalkan.",
+		"nothing_to_cancel":        "ℹ️ Tidak ada perintah yang sedang berjalan.",
+		"conversation_expired":     "⌛ Sesi ini sudah berakhir. Silakan ulangi perintahnya.",
+		"unknown_command":          "⚠️ Perintah /%s tidak dikenal. Ketik /help untuk melihat daftar perintah.",
+		"cmd_start":                "Mulai percakapan dengan bot",
+		"cmd_help":                 "Panduan penggunaan bot",
+		"cmd_ulasan":               "Link ulasan sebuah buku",
+		"cmd_beriulasan":           "Tulis ulasan dan rating buku",
+		"cmd_bahasa":               "Ganti bahasa bot (id/en)",
+		"cmd_batal":                "Batalkan perintah yang sedang berjalan",
+		"cmd_moderasi":             "Moderasi ulasan pengguna (admin)",
+		"cmd_start_help":           "/start\nMenampilkan pesan selamat datang.\n\n/start [kata kunci]\nLangsung mencari buku, dipakai oleh link t.me/bot?start=kata_kunci.",
+		"cmd_help_help":            "/help [perintah]\nMenampilkan panduan umum, atau bantuan lengkap perintah yang disebutkan.\nAlias: /bantuan",
+		"cmd_ulasan_help":          "/ulasan [judul produk]\nMengirim link ulasan buku. Judul boleh tidak lengkap dan huruf besar/kecil tidak berpengaruh. Tanpa judul, bot akan menanyakannya.\nContoh: /ulasan ilmu hacking\nAlias: /review",
+		"cmd_beriulasan_help":      "/beriulasan [judul produk]\nMenulis ulasan dan memberi rating 1-5 untuk sebuah buku. Ulasan tampil setelah disetujui admin.\nAlias: /tulisulasan",
+		"cmd_bahasa_help":          "/bahasa [id|en]\nMengganti bahasa balasan bot. Tanpa argumen, bot akan menanyakan bahasanya.\nAlias: /language, /lang",
+		"cmd_batal_help":           "/batal\nMembatalkan perintah yang sedang menunggu jawaban.\nAlias: /cancel",
+		"cmd_moderasi_help":        "/moderasi\nMenampilkan ulasan yang menunggu moderasi beserta tombol setujui/tolak. Khusus admin.",
+		"cmd_pengaturan":           "Pengaturan bot di grup (admin grup)",
+		"cmd_pengaturan_help":      "/pengaturan\nMenampilkan dan mengubah pengaturan bot di grup ini, misalnya apakah semua pesan dianggap pencarian dan jumlah hasil yang ditampilkan. Khusus admin grup.\nAlias: /settings",
+		"group_more_results":       "…dan %d buku lainnya. <a href=\"%s\">Lihat semua hasil di chat pribadi</a>.",
+		"group_settings":           "⚙️ Pengaturan grup\n\n🔍 Anggap semua pesan sebagai pencarian: %s\n📚 Jumlah hasil ditampilkan: %d\n\nSecara bawaan bot hanya menanggapi perintah, mention, dan balasan ke pesannya.",
+		"group_toggle_search_all":  "🔍 Ubah pencarian semua pesan",
+		"group_only":               "ℹ️ Perintah ini hanya bisa digunakan di grup.",
+		"group_admin_only":         "⛔ Hanya admin grup yang bisa mengubah pengaturan ini.",
+		"setting_on":               "aktif",
+		"setting_off":              "nonaktif",
+		"cmd_kategori":             "Jelajahi buku per kategori",
+		"cmd_kategori_help":        "/kategori [nama kategori]\nMenampilkan kategori buku sebagai tombol. Pilih kategori untuk melihat daftar bukunya per halaman, lalu pilih buku untuk melihat link pembeliannya.\nContoh: /kategori pemrograman\nAlias: /category",
+		"category_choose":          "🗂️ Pilih kategori buku:",
+		"category_page":            "🗂️ %s (%d buku)\nHalaman %d dari %d. Pilih buku untuk melihat link pembeliannya.",
+		"category_back":            "⬅️ Semua kategori",
+		"page_prev":                "◀️ Sebelumnya",
+		"page_next":                "Berikutnya ▶️",
+		"cmd_toko":                 "Pilih toko favorit",
+		"cmd_toko_help":            "/toko [nama toko|semua]\nMemilih toko favorit. Link toko favorit selalu ditampilkan paling atas di hasil pencarian. Ketik /toko semua untuk kembali menampilkan semua toko tanpa urutan khusus.\nUntuk hanya menampilkan satu toko, tambahkan filter toko:<nama> ke pencarian, misalnya: python toko:gramedia\nAlias: /store",
+		"store_choose":             "🏬 Toko favorit saat ini: %s\nPilih toko favorit Anda:",
+		"store_set":                "✅ Toko favorit diatur ke %s. Link %s akan ditampilkan paling atas.",
+		"store_cleared":            "✅ Toko favorit dihapus. Semua toko ditampilkan.",
+		"store_group_usage":        "Admin grup bisa mengatur toko bawaan grup dengan /toko grup <nama toko|semua>.",
+		"store_set_group":          "✅ Toko bawaan grup diatur ke %s. Link %s ditampilkan paling atas untuk anggota yang belum memilih toko favorit sendiri.",
+		"store_cleared_group":      "✅ Toko bawaan grup dihapus.",
+		"store_unknown":            "⚠️ Toko %s tidak dikenal. Toko yang tersedia: %s",
+		"store_all":                "Semua toko",
+		"store_product_missing":    "⚠️ Produk tidak ditemukan di %s.",
+		"cmd_datasaya":             "Unduh data Anda yang disimpan bot",
+		"cmd_datasaya_help":        "/datasaya\nMengirim file JSON berisi semua data Anda yang disimpan bot: profil, riwayat pesan, pengaturan, ulasan, pencarian, dan klik link toko. Hanya bisa dipakai di chat pribadi.\nAlias: /mydata",
+		"cmd_hapusdata":            "Hapus semua data Anda dari bot",
+		"cmd_hapusdata_help":       "/hapusdata\nMenghapus semua data Anda yang disimpan bot setelah Anda mengonfirmasi: profil, riwayat pesan, pengaturan, ulasan, pencarian, dan klik link toko. Hanya bisa dipakai di chat pribadi.\nAlias: /deletedata",
+		"private_only":             "🔒 Perintah ini hanya bisa dipakai di chat pribadi dengan bot.",
+		"data_export_caption":      "📦 Ini semua data Anda yang disimpan bot.",
+		"data_export_failed":       "⚠️ Gagal menyiapkan data Anda. Silakan coba lagi nanti.",
+		"data_delete_confirm":      "🗑️ Hapus semua data Anda dari bot? Profil, riwayat pesan, pengaturan, ulasan, pencarian, dan klik link toko Anda akan dihapus permanen.",
+		"data_delete_yes":          "🗑️ Ya, hapus",
+		"data_delete_no":           "Batal",
+		"data_deleted":             "✅ Semua data Anda sudah dihapus.",
+		"data_delete_cancelled":    "👌 Penghapusan data dibatalkan.",
+		"data_delete_failed":       "⚠️ Gagal menghapus data Anda. Silakan coba lagi nanti.",
+		"cmd_berhenti":             "Berhenti menerima pengumuman",
+		"cmd_berhenti_help":        "/berhenti\nBerhenti menerima pengumuman buku baru dan promo dari admin. Ketik /langganan untuk menerimanya lagi.\nAlias: /unsubscribe",
+		"cmd_langganan":            "Terima lagi pengumuman",
+		"cmd_langganan_help":       "/langganan\nKembali menerima pengumuman buku baru dan promo setelah /berhenti.\nAlias: /subscribe",
+		"cmd_broadcast":            "Kirim pengumuman ke pengguna (admin)",
+		"cmd_broadcast_help":       "/broadcast [segmen:<semua|aktif|id|en>] <pesan>\nMenampilkan pratinjau pengumuman beserta jumlah penerimanya, lalu mengirimnya setelah dikonfirmasi. Tanpa pesan, menampilkan status pengumuman terakhir. Khusus admin.",
+		"unsubscribed":             "🔕 Anda tidak akan menerima pengumuman lagi. Ketik /langganan untuk menerimanya kembali.",
+		"subscribed":               "🔔 Anda akan kembali menerima pengumuman.",
+		"subscription_failed":      "⚠️ Gagal menyimpan pilihan Anda. Silakan coba lagi nanti.",
+		"broadcast_usage":          "📣 /broadcast [segmen:<semua|aktif|id|en>] <pesan>\nSegmen aktif berisi pengguna yang mengirim pesan dalam 30 hari terakhir.",
+		"broadcast_footer":         "Ketik /berhenti untuk berhenti menerima pengumuman.",
+		"broadcast_preview":        "📣 Pratinjau pengumuman untuk segmen %s (%d pengguna):",
+		"broadcast_send":           "📣 Kirim",
+		"broadcast_cancel":         "Batal",
+		"broadcast_stop":           "⏹️ Hentikan",
+		"broadcast_bad_segment":    "⚠️ Segmen %s tidak dikenal. Pilih semua, aktif, id, atau en.",
+		"broadcast_no_recipients":  "ℹ️ Tidak ada pengguna di segmen %s yang bisa menerima pengumuman.",
+		"broadcast_failed":         "⚠️ Gagal menyiapkan pengumuman. Silakan coba lagi nanti.",
+		"broadcast_unavailable":    "⚠️ Pengumuman ini sudah dikirim, dibatalkan, atau tidak ditemukan.",
+		"broadcast_status":         "📣 Pengumuman #%d (%s), segmen %s, %d penerima\n✅ %d terkirim · ⚠️ %d gagal · 🚫 %d memblokir bot · ⏳ %d menunggu",
+		"broadcast_draft":          "draf",
+		"broadcast_sending":        "sedang dikirim",
+		"broadcast_done":           "selesai",
+		"broadcast_cancelled":      "dibatalkan",
+		"cmd_tambahbuku":           "Tambah buku ke katalog (admin)",
+		"cmd_tambahbuku_help":      "/tambahbuku <judul>\nKategori: <kategori>\n<Toko>: <link>\nMenambahkan buku ke katalog. Baris kategori dan link toko boleh lebih dari satu atau dilewati; tanpa kategori, kategori ditebak dari judul. Langsung muncul di pencarian. Khusus admin.\nAlias: /addbook",
+		"cmd_editbuku":             "Ubah judul atau kategori buku (admin)",
+		"cmd_editbuku_help":        "/editbuku <judul>\nJudul: <judul baru>\nKategori: <kategori baru>\nMengubah judul dan/atau kategori sebuah buku. Khusus admin.\nAlias: /editbook",
+		"cmd_hapusbuku":            "Hapus buku dari katalog (admin)",
+		"cmd_hapusbuku_help":       "/hapusbuku <judul>\nMenghapus buku dari katalog. Judul harus lengkap. Khusus admin.\nAlias: /deletebook",
+		"cmd_tambahlink":           "Tambah link toko ke buku (admin)",
+		"cmd_tambahlink_help":      "/tambahlink <judul>\n<Toko>: <link>\nMenambahkan link toko ke sebuah buku, atau mengganti link toko yang sudah ada. Khusus admin.\nAlias: /addlink",
+		"catalog_usage_add":        "ℹ️ Format: /tambahbuku <judul>, lalu di baris berikutnya boleh ditambah \"Kategori: <kategori>\" dan \"<Toko>: <link>\".",
+		"catalog_usage_edit":       "ℹ️ Format: /editbuku <judul>, lalu di baris berikutnya \"Judul: <judul baru>\" dan/atau \"Kategori: <kategori baru>\".",
+		"catalog_usage_delete":     "ℹ️ Format: /hapusbuku <judul lengkap>",
+		"catalog_usage_link":       "ℹ️ Format: /tambahlink <judul>, lalu di baris berikutnya \"<Toko>: <link>\".",
+		"catalog_added":            "✅ Buku %s ditambahkan ke katalog.",
+		"catalog_edited":           "✅ Buku %s diperbarui.",
+		"catalog_deleted":          "🗑️ Buku %s dihapus dari katalog.",
+		"catalog_link_added":       "✅ Link %s ditambahkan ke buku %s.",
+		"catalog_exists":           "⚠️ Buku %s sudah ada di katalog.",
+		"catalog_not_found":        "⚠️ Buku %s tidak ditemukan di katalog.",
+		"catalog_suggestions":      "Mungkin maksud Anda:",
+		"catalog_invalid_link":     "⚠️ Link %s tidak valid. Link harus diawali http:// atau https:// dan berisi nama domain.",
+		"catalog_failed":           "⚠️ Gagal mengubah katalog. Silakan coba lagi nanti.",
+		"admin_only":               "⛔ Perintah ini hanya untuk admin.",
+		"moderation_review":        "🆕 Ulasan baru menunggu moderasi\n📖 Buku: %s\n👤 Pengguna: @%s (%d)\n⭐ Rating: %d/5\n📝 %s",
+		"moderation_approve":       "✅ Setujui",
+		"moderation_reject":        "❌ Tolak",
+		"moderation_pending":       "📋 %d ulasan menunggu moderasi.",
+		"moderation_done_approved": "✅ Ulasan %s dari @%s disetujui.",
+		"moderation_done_rejected": "❌ Ulasan %s dari @%s ditolak.",
+		"moderation_already":       "ℹ️ Ulasan %s dari @%s sudah dimoderasi (%s).",
+		"user_reviews_button":      "💬 Ulasan pembaca (%d)",
+		"user_reviews":             "💬 Ulasan pembaca untuk %s:",
+		"user_reviews_empty":       "Belum ada ulasan pembaca untuk %s.",
+	},
+	LangEN: {
+		"start": "📚 Welcome to BookFinderBot! I'm an Ebook & Book finder bot. What Ebook are you looking for? Type the title or topic you want and I'll find it for you.",
+		"help": `ℹ️ Use this bot to find Ebooks & Books. Just type the title or topic you're looking for and I'll find it for you.
+
+🔍 Examples:
+Type "Learn Python" to find Ebooks or Books about Python programming.
+Type "Hacking" to find Ebooks or Books about hacking.
+Type "python toko:gramedia" to only show links from Gramedia.
+
+📖 You can also use these commands:
+%s
+
+Type /help [command] for the full help of a command, for example /help ulasan.
+
+💡 Tip: The title doesn't have to be complete and upper/lower case doesn't matter. If several books match, pick one from the buttons shown.
+
+📘 Example:
+/ulasan Ilmu Hacking
+to get the review link for the book Ilmu Hacking.
+
+📝 Note:
+You can also submit a review right here with the /beriulasan command.`,
+		"review_found":             "📘 Review link for %s:\n%s",
+		"review_not_found":         "⚠️ No review link found for %s.\nYou can submit a review with the /beriulasan command.",
+		"review_choose":            "🔎 Several books match \"%s\". Pick the book whose review you want to see:",
+		"product_title":            "📖 Title: %s",
+		"review_button":            "📘 Read review",
+		"product_missing":          "⚠️ Product not found.",
+		"language_usage":           "🌐 Current language: English.\nType id for Bahasa Indonesia, en for English, or auto to follow your Telegram app.",
+		"language_group_usage":     "Group admins can set the default language of the group with /bahasa grup id, en or auto.",
+		"language_invalid":         "⚠️ Language %s is not supported. Available options: id, en, auto.",
+		"language_set":             "✅ Language changed to English.",
+		"language_set_group":       "✅ The default language of the group is now English. Members who picked their own language with /bahasa keep it.",
+		"language_auto":            "✅ The language follows your Telegram app again.",
+		"language_auto_group":      "✅ The group has no default language anymore. Every member is answered in the language they picked or the one of their Telegram app.",
+		"product_rating":           "⭐ %s/5 (%d reviews)",
+		"submit_ask_title":         "✍️ Which book do you want to review? Type its title.",
+		"submit_not_found":         "⚠️ Book %s not found. Try typing another title.",
+		"submit_choose":            "🔎 Several books match \"%s\". Pick the book you want to review:",
+		"submit_ask_rating":        "⭐ How many stars for %s? Pick 1 to 5.",
+		"submit_ask_text":          "📝 You gave %d stars. Now write your review.",
+		"submit_text_required":     "📝 A review must be text. Write your review, or type /cancel.",
+		"submit_thanks":            "🙏 Thank you! Your review will be published after an admin checks it.",
+		"submit_failed":            "⚠️ Sorry, your review could not be saved. Please try again later.",
+		"submit_approved":          "✅ Your review of %s has been published. Thank you!",
+		"submit_rejected":          "❌ Sorry, your review of %s was not approved by an admin.",
+		"review_ask_title":         "📘 Which book's review do you want to see? Type its title.",
+		"cancel_hint":              "Type /batal to cancel.",
+		"cancelled":                "✅ Cancelled.",
+		"nothing_to_cancel":        "ℹ️ There is no command in progress.",
+		"conversation_expired":     "⌛ This session has expired. Please start the command again.",
+		"unknown_command":          "⚠️ Unknown command /%s. Type /help to see the list of commands.",
+		"cmd_start":                "Start a conversation with the bot",
+		"cmd_help":                 "How to use the bot",
+		"cmd_ulasan":               "Review link of a book",
+		"cmd_beriulasan":           "Write a review and rate a book",
+		"cmd_bahasa":               "Change the bot language (id/en)",
+		"cmd_batal":                "Cancel the command in progress",
+		"cmd_moderasi":             "Moderate user reviews (admin)",
+		"cmd_start_help":           "/start\nShows the welcome message.\n\n/start [keywords]\nSearches books right away, used by t.me/bot?start=keywords links.",
+		"cmd_help_help":            "/help [command]\nShows the general help, or the full help of the given command.\nAlias: /bantuan",
+		"cmd_ulasan_help":          "/ulasan [product title]\nSends the review link of a book. The title may be partial and case doesn't matter. Without a title the bot asks for it.\nExample: /ulasan ilmu hacking\nAlias: /review",
+		"cmd_beriulasan_help":      "/beriulasan [product title]\nWrite a review and give a 1-5 rating for a book. Reviews are shown after an admin approves them.\nAlias: /tulisulasan",
+		"cmd_bahasa_help":          "/bahasa [id|en]\nChanges the bot reply language. Without an argument the bot asks for it.\nAlias: /language, /lang",
+		"cmd_batal_help":           "/batal\nCancels the command waiting for your answer.\nAlias: /cancel",
+		"cmd_moderasi_help":        "/moderasi\nShows the reviews waiting for moderation with approve/reject buttons. Admins only.",
+		"cmd_pengaturan":           "Bot settings for the group (group admins)",
+		"cmd_pengaturan_help":      "/pengaturan\nShows and changes the bot settings of this group, such as whether every message is treated as a search and how many results are shown. Group admins only.\nAlias: /settings",
+		"group_more_results":       "…and %d more books. <a href=\"%s\">See all results in a private chat</a>.",
+		"group_settings":           "⚙️ Group settings\n\n🔍 Treat every message as a search: %s\n📚 Results shown: %d\n\nBy default the bot only answers commands, mentions and replies to its messages.",
+		"group_toggle_search_all":  "🔍 Toggle searching every message",
+		"group_only":               "ℹ️ This command can only be used in groups.",
+		"group_admin_only":         "⛔ Only group admins can change this setting.",
+		"setting_on":               "on",
+		"setting_off":              "off",
+		"cmd_kategori":             "Browse books by category",
+		"cmd_kategori_help":        "/kategori [category name]\nShows the book categories as buttons. Pick a category to list its books page by page, then pick a book to see where to buy it.\nExample: /kategori pemrograman\nAlias: /category",
+		"category_choose":          "🗂️ Pick a book category:",
+		"category_page":            "🗂️ %s (%d books)\nPage %d of %d. Pick a book to see where to buy it.",
+		"category_back":            "⬅️ All categories",
+		"page_prev":                "◀️ Previous",
+		"page_next":                "Next ▶️",
+		"cmd_toko":                 "Choose your favorite store",
+		"cmd_toko_help":            "/toko [store name|semua]\nChooses your favorite store. Its links are always listed first in search results. Type /toko semua to show every store again without a particular order.\nTo show a single store only, add a toko:<name> filter to your search, for example: python toko:gramedia\nAlias: /store",
+		"store_choose":             "🏬 Current favorite store: %s\nPick your favorite store:",
+		"store_set":                "✅ Favorite store set to %s. %s links will be listed first.",
+		"store_cleared":            "✅ Favorite store cleared. All stores are shown.",
+		"store_group_usage":        "Group admins can set the default store of the group with /toko grup <store|semua>.",
+		"store_set_group":          "✅ Default store of the group set to %s. %s links are listed first for members who didn't pick their own favorite store.",
+		"store_cleared_group":      "✅ Default store of the group cleared.",
+		"store_unknown":            "⚠️ Unknown store %s. Available stores: %s",
+		"store_all":                "All stores",
+		"store_product_missing":    "⚠️ Product not found at %s.",
+		"cmd_datasaya":             "Download your data stored by the bot",
+		"cmd_datasaya_help":        "/datasaya\nSends a JSON file with all your data stored by the bot: profile, message history, settings, reviews, searches and store link clicks. Only works in a private chat.\nAlias: /mydata",
+		"cmd_hapusdata":            "Delete all your data from the bot",
+		"cmd_hapusdata_help":       "/hapusdata\nDeletes all your data stored by the bot once you confirm: profile, message history, settings, reviews, searches and store link clicks. Only works in a private chat.\nAlias: /deletedata",
+		"private_only":             "🔒 This command only works in a private chat with the bot.",
+		"data_export_caption":      "📦 Here is all your data stored by the bot.",
+		"data_export_failed":       "⚠️ Couldn't prepare your data. Please try again later.",
+		"data_delete_confirm":      "🗑️ Delete all your data from the bot? Your profile, message history, settings, reviews, searches and store link clicks will be permanently deleted.",
+		"data_delete_yes":          "🗑️ Yes, delete",
+		"data_delete_no":           "Cancel",
+		"data_deleted":             "✅ All your data has been deleted.",
+		"data_delete_cancelled":    "👌 Data deletion cancelled.",
+		"data_delete_failed":       "⚠️ Couldn't delete your data. Please try again later.",
+		"cmd_berhenti":             "Stop receiving announcements",
+		"cmd_berhenti_help":        "/berhenti\nStops the announcements of new books and promotions from the admins. Type /langganan to receive them again.\nAlias: /unsubscribe",
+		"cmd_langganan":            "Receive announcements again",
+		"cmd_langganan_help":       "/langganan\nReceive announcements of new books and promotions again after /berhenti.\nAlias: /subscribe",
+		"cmd_broadcast":            "Send an announcement to users (admin)",
+		"cmd_broadcast_help":       "/broadcast [segmen:<semua|aktif|id|en>] <message>\nShows a preview of the announcement with its number of recipients, then sends it once confirmed. Without a message, shows the status of the latest announcements. Admins only.",
+		"unsubscribed":             "🔕 You won't receive announcements anymore. Type /langganan to receive them again.",
+		"subscribed":               "🔔 You will receive announcements again.",
+		"subscription_failed":      "⚠️ Failed to save your choice. Please try again later.",
+		"broadcast_usage":          "📣 /broadcast [segmen:<semua|aktif|id|en>] <message>\nThe aktif segment holds the users who wrote to the bot in the last 30 days.",
+		"broadcast_footer":         "Type /berhenti to stop receiving announcements.",
+		"broadcast_preview":        "📣 Preview of the announcement for segment %s (%d users):",
+		"broadcast_send":           "📣 Send",
+		"broadcast_cancel":         "Cancel",
+		"broadcast_stop":           "⏹️ Stop",
+		"broadcast_bad_segment":    "⚠️ Unknown segment %s. Choose semua, aktif, id or en.",
+		"broadcast_no_recipients":  "ℹ️ No user of segment %s can receive announcements.",
+		"broadcast_failed":         "⚠️ Failed to prepare the announcement. Please try again later.",
+		"broadcast_unavailable":    "⚠️ This announcement was already sent, cancelled or not found.",
+		"broadcast_status":         "📣 Announcement #%d (%s), segment %s, %d recipients\n✅ %d delivered · ⚠️ %d failed · 🚫 %d blocked the bot · ⏳ %d pending",
+		"broadcast_draft":          "draft",
+		"broadcast_sending":        "sending",
+		"broadcast_done":           "done",
+		"broadcast_cancelled":      "cancelled",
+		"cmd_tambahbuku":           "Add a book to the catalog (admin)",
+		"cmd_tambahbuku_help":      "/tambahbuku <title>\nKategori: <category>\n<Store>: <link>\nAdds a book to the catalog. The category and store link lines may be repeated or left out; without a category, it is guessed from the title. Shows up in searches right away. Admins only.\nAlias: /addbook",
+		"cmd_editbuku":             "Rename a book or change its category (admin)",
+		"cmd_editbuku_help":        "/editbuku <title>\nJudul: <new title>\nKategori: <new category>\nChanges the title and/or the category of a book. Admins only.\nAlias: /editbook",
+		"cmd_hapusbuku":            "Remove a book from the catalog (admin)",
+		"cmd_hapusbuku_help":       "/hapusbuku <title>\nRemoves a book from the catalog. The title must be complete. Admins only.\nAlias: /deletebook",
+		"cmd_tambahlink":           "Add a store link to a book (admin)",
+		"cmd_tambahlink_help":      "/tambahlink <title>\n<Store>: <link>\nAdds a store link to a book, or replaces the link of a store it already has. Admins only.\nAlias: /addlink",
+		"catalog_usage_add":        "ℹ️ Format: /tambahbuku <title>, optionally followed by \"Kategori: <category>\" and \"<Store>: <link>\" lines.",
+		"catalog_usage_edit":       "ℹ️ Format: /editbuku <title>, followed by \"Judul: <new title>\" and/or \"Kategori: <new category>\" lines.",
+		"catalog_usage_delete":     "ℹ️ Format: /hapusbuku <complete title>",
+		"catalog_usage_link":       "ℹ️ Format: /tambahlink <title>, followed by \"<Store>: <link>\" lines.",
+		"catalog_added":            "✅ Book %s added to the catalog.",
+		"catalog_edited":           "✅ Book %s updated.",
+		"catalog_deleted":          "🗑️ Book %s removed from the catalog.",
+		"catalog_link_added":       "✅ %s link added to book %s.",
+		"catalog_exists":           "⚠️ Book %s is already in the catalog.",
+		"catalog_not_found":        "⚠️ Book %s was not found in the catalog.",
+		"catalog_suggestions":      "Did you mean:",
+		"catalog_invalid_link":     "⚠️ Link %s is not valid. Links must start with http:// or https:// and contain a domain name.",
+		"catalog_failed":           "⚠️ Failed to change the catalog. Please try again later.",
+		"admin_only":               "⛔ This command is for admins only.",
+		"moderation_review":        "🆕 New review awaiting moderation\n📖 Book: %s\n👤 User: @%s (%d)\n⭐ Rating: %d/5\n📝 %s",
+		"moderation_approve":       "✅ Approve",
+		"moderation_reject":        "❌ Reject",
+		"moderation_pending":       "📋 %d reviews awaiting moderation.",
+		"moderation_done_approved": "✅ Review of %s by @%s approved.",
+		"moderation_done_rejected": "❌ Review of %s by @%s rejected.",
+		"moderation_already":       "ℹ️ The review of %s by @%s was already moderated (%s).",
+		"user_reviews_button":      "💬 Reader reviews (%d)",
+		"user_reviews":             "💬 Reader reviews of %s:",
+		"user_reviews_empty":       "No reader reviews of %s yet.",
+	},
+}
+
+// tr returns the catalog message for key in lang, formatted with args.
+// Missing languages or keys fall back to the default language.
+func tr(lang, key string, args ...interface{}) string {
+	text, ok := messages[lang][key]
+	if !ok {
+		text = messages[defaultLanguage][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// normalizeLanguage maps a Telegram language_code (IETF tag) to a supported language.
+// It returns an empty string if the code is not supported.
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	switch code {
+	case LangID, "in":
+		return LangID
+	case LangEN:
+		return LangEN
+	}
+	return ""
+}
+
+// detectLanguage picks a language from the user's Telegram language_code.
+// Indonesian clients and clients without a code get Indonesian, everyone else English.
+func detectLanguage(code string) string {
+	if code == "" {
+		return defaultLanguage
+	}
+	if lang := normalizeLanguage(code); lang != "" {
+		return lang
+	}
+	return LangEN
+}
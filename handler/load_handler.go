@@ -19,6 +19,12 @@ func Load() ([]Product, []ReviewLink, error) {
 		return nil, nil, fmt.Errorf("Gagal memuat link review: %v", err)
 	}
 
+	// Infer the category of products without a "Kategori:" line
+	assignCategories(products)
+
+	// Attach review links to their products
+	reportUnmatchedReviewLinks(joinReviewLinks(products, reviewLinks))
+
 	// Save products to JSON file
 	err = saveProductsToJson(products, "products.json")
 	if err != nil {
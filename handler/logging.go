@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hashSaltFile keeps the salt generated for the ID hashes when LOG_HASH_SALT is not set
+const hashSaltFile = "hash_salt"
+
+// requestIDHeader carries the correlation ID of a webhook request, taken from the caller when present
+const requestIDHeader = "X-Request-ID"
+
+// botTokenPattern matches Telegram bot tokens, as found in Bot API and file URLs
+var botTokenPattern = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}`)
+
+// newRequestID returns a random correlation ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logHashSalt is the salt of the ID hashes, set once on startup by InitHashSalt
+var logHashSalt string
+
+// InitHashSalt sets the salt of the ID hashes to LOG_HASH_SALT, or to a random salt generated on the first start
+// and kept in the hash_salt file. Without a salt the hashes could be reversed by hashing every possible ID.
+func InitHashSalt() error {
+	if salt := os.Getenv("LOG_HASH_SALT"); salt != "" {
+		logHashSalt = salt
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(hashSaltFile)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		logHashSalt = strings.TrimSpace(string(data))
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	salt := hex.EncodeToString(b)
+	if err := ioutil.WriteFile(hashSaltFile, []byte(salt+"\n"), 0600); err != nil {
+		return err
+	}
+	logHashSalt = salt
+	logrus.WithFields(logrus.Fields{
+		"file": hashSaltFile,
+	}).Info("Generated hash salt")
+	return nil
+}
+
+// hashSalt returns the salt of the ID hashes
+func hashSalt() string {
+	return logHashSalt
+}
+
+// saltedHash returns the full salted hash of a Telegram user or chat ID
+func saltedHash(id int64) string {
+	sum := sha256.Sum256([]byte(hashSalt() + strconv.FormatInt(id, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashID pseudonymizes a Telegram user or chat ID for the logs
+func hashID(id int64) string {
+	return saltedHash(id)[:12]
+}
+
+// logUserContent reports whether message texts may be written to the logs, set with LOG_USER_CONTENT=true
+func logUserContent() bool {
+	return strings.EqualFold(os.Getenv("LOG_USER_CONTENT"), "true")
+}
+
+// redactText returns a message text as it may appear in the logs
+func redactText(text string) string {
+	if logUserContent() {
+		return redactSecrets(text)
+	}
+	return fmt.Sprintf("[redacted %d chars]", len([]rune(text)))
+}
+
+// redactSecrets hides bot tokens and the configured secrets in a log string
+func redactSecrets(s string) string {
+	s = botTokenPattern.ReplaceAllString(s, "[redacted-token]")
+	for _, name := range []string{"TELEGRAM_BOT_TOKEN", "REDIRECT_SECRET", "ADMIN_TOKEN"} {
+		if secret := os.Getenv(name); len(secret) >= 8 {
+			s = strings.ReplaceAll(s, secret, "[redacted]")
+		}
+	}
+	return s
+}
+
+// SecretRedactionHook removes secrets from the message and fields of every log entry,
+// e.g. the bot token inside the URL of a failed Bot API call
+type SecretRedactionHook struct{}
+
+// Levels returns the levels the hook applies to, all of them
+func (SecretRedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the entry before it is formatted
+func (SecretRedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = redactSecrets(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = redactSecrets(v)
+		case error:
+			entry.Data[key] = redactSecrets(v.Error())
+		}
+	}
+	return nil
+}
@@ -3,210 +3,522 @@ package handler
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/1amkaizen/BookFinderBot/metrics"
 	datauser "github.com/1amkaizen/BookFinderBot/user"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
-func handleMessage(update *tgbotapi.Update, bot *tgbotapi.BotAPI, products []Product, reviewLinks []ReviewLink) {
+// userDataFile is the JSON file holding user records and conversations
+const userDataFile = "user_data.json"
+
+// maxReviewChoices limits the number of books offered when a review title is ambiguous
+const maxReviewChoices = 10
+
+// userDataMu serializes read-modify-write cycles on the user data file
+var userDataMu sync.Mutex
+
+func handleMessage(update *tgbotapi.Update, bot *tgbotapi.BotAPI, catalog *Catalog, reviewLinks []ReviewLink, entry *logrus.Entry) {
 	userInfo := update.Message.From
-	logMessage := fmt.Sprintf(
-		"%sUsername: %s%s\n%sUser ID: %d%s\n%sChat ID: %d%s\n%sMessage: %s%s",
-		Green, userInfo.UserName, Reset,
-		Green, userInfo.ID, Reset,
-		Green, update.Message.Chat.ID, Reset,
-		Green, update.Message.Text, Reset,
-	)
-	logrus.Info(logMessage)
+	if userInfo == nil {
+		return
+	}
+
+	// Di grup, bot hanya menanggapi perintah, mention, dan balasan ke pesannya
+	var group *GroupSettings
+	implicit := false
+	if isGroupChat(update.Message.Chat) {
+		settings := getGroupSettings(update.Message.Chat)
+		if !addressedToBot(update.Message, bot, settings) {
+			return
+		}
+		group = &settings
+		implicit = !explicitlyAddressed(update.Message, bot)
+	}
+
+	parsed, isCommand := parseCommand(update.Message, bot.Self.UserName)
+	entry = entry.WithFields(logrus.Fields{
+		"chat_id_hash": hashID(update.Message.Chat.ID),
+		"user_id_hash": hashID(userInfo.ID),
+		"chat_type":    update.Message.Chat.Type,
+	})
+	logFields := logrus.Fields{"text": redactText(update.Message.Text)}
+	if isCommand {
+		logFields["command"] = parsed.Name
+	}
+	entry.WithFields(logFields).Info("Message received")
+
+	// Abaikan perintah untuk bot lain, misalnya /start@OtherBot di grup
+	if isCommand && parsed.OtherBot {
+		return
+	}
+	// Perintah tak dikenal tanpa @bot di grup kemungkinan untuk bot lain, jadi bot diam saja
+	if isCommand && group != nil && !parsed.ToBot {
+		if _, found := findCommand(parsed.Name); !found {
+			return
+		}
+	}
 
 	currenttime := time.Now()
+
+	// Data pengguna dimuat sekali untuk handoff, bahasa, dan percakapan pembaruan ini
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		entry.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user data")
+		db = &datauser.Database{}
+	}
+
+	// Selama admin menangani chat pribadi, pesan biasa hanya disimpan tanpa dibalas bot
+	if group == nil && !isCommand && chatHandedOff(db, update.Message.Chat.ID) {
+		entry.Info("Bot replies paused for human handoff")
+		saveUserData(update, nil, currenttime, getProfilePhotoFileID(bot, userInfo.ID))
+		return
+	}
+
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
-	var botResponse string
+	if group != nil {
+		msg.ReplyToMessageID = update.Message.MessageID
+	}
+	out := newSender(bot, userInfo.ID)
+
+	profilePhotoFileID := getProfilePhotoFileID(bot, userInfo.ID)
+	lang := chatLanguage(db, update.Message.Chat.ID, userInfo.ID, userInfo.LanguageCode)
 
-	profilePhotoURL := getProfilePhotoURL(bot, userInfo.ID)
+	conversation, inConversation, expired := findConversation(db, update.Message.Chat.ID, userInfo.ID)
+	if inConversation && isCommand && !parsed.OtherBot {
+		// Perintah baru selalu mengakhiri percakapan yang sedang berjalan
+		clearConversation(update.Message.Chat.ID, userInfo.ID)
+	}
 
-	switch update.Message.Text {
-	case "/start", "/help", "/ulasan":
-		botResponse = processCommand(update.Message.Text)
-		msg.Text = botResponse
+	ctx := &messageContext{
+		Update:         update,
+		Bot:            out,
+		Catalog:        catalog,
+		Products:       catalog.Products(),
+		ReviewLinks:    reviewLinks,
+		Lang:           lang,
+		InConversation: inConversation,
+		Group:          group,
+		Implicit:       implicit,
+		Msg:            &msg,
+		Log:            entry,
+	}
+
+	switch {
+	case isCommand:
+		runCommand(ctx, parsed)
+	case inConversation:
+		continueConversation(ctx, conversation)
+	case expired && !implicit:
+		// Pesan ini kemungkinan jawaban untuk percakapan yang sudah berakhir, jadi jangan dijadikan pencarian
+		ctx.reply(tr(lang, "conversation_expired"))
 	default:
-		handleGeneralMessage(update, bot, products, reviewLinks, &msg, &botResponse)
+		handleProductSearch(ctx, stripBotMention(update.Message.Text, bot.Self.UserName))
 	}
 
 	if msg.Text != "" {
-		if _, err := bot.Send(msg); err != nil {
-			logrus.WithFields(logrus.Fields{
+		if _, err := out.sendResults(msg, ctx.Results); err != nil {
+			entry.WithFields(logrus.Fields{
 				"error": err,
 			}).Error("Failed to send message")
 		}
 	}
 
-	saveUserData(update, botResponse, currenttime, profilePhotoURL)
+	saveUserData(update, out.sent, currenttime, profilePhotoFileID)
 }
 
-func processCommand(command string) string {
-	switch command {
-	case "/start":
-		return "📚 Selamat datang di BookFinderBot! Saya adalah bot pencari Ebook & Buku. Cari Ebook apa yang Anda butuhkan? Ketikkan judul atau topik yang Anda inginkan, dan saya akan mencarikannya untuk Anda."
-	case "/help":
-		return `ℹ️ Gunakan bot ini untuk mencari Ebook & Buku. Anda cukup ketik judul atau topik yang ingin Anda cari, dan saya akan mencarikannya untuk Anda.
+// handleReviewLink replies with the review link of the given title and reports whether any reviewed book matched
+func handleReviewLink(ctx *messageContext, productName string) bool {
+	productName = strings.TrimSpace(productName)
+	reviewLinks := ctx.ReviewLinks
+	found := findReviewLinks(reviewLinks, productName)
+	switch len(found) {
+	case 0:
+		ctx.reply(tr(ctx.Lang, "review_not_found", productName))
+	case 1:
+		reviewLink := reviewLinks[found[0]]
+		ctx.reply(tr(ctx.Lang, "review_found", reviewLink.ProductName, reviewLink.Link))
+	default:
+		// Beberapa buku cocok, minta pengguna memilih salah satunya
+		if len(found) > maxReviewChoices {
+			found = found[:maxReviewChoices]
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, index := range found {
+			button := tgbotapi.NewInlineKeyboardButtonData(reviewLinks[index].ProductName, callbackReview+strconv.Itoa(index))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+		}
+		ctx.reply(tr(ctx.Lang, "review_choose", productName))
+		ctx.Msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	return len(found) > 0
+}
 
-🔍 Contoh penggunaan:
-Ketikkan "Belajar Python" untuk mencari Ebook atau Buku tentang pemrograman Python.
-Ketikkan "Hacking" untuk mencari Ebook atau Buku tentang hacking.
+// continueReviewLookup answers the title asked for by a bare /ulasan
+func continueReviewLookup(ctx *messageContext, conversation *datauser.Conversation) {
+	if handleReviewLink(ctx, ctx.Update.Message.Text) {
+		clearConversation(ctx.ChatID(), ctx.UserID())
+		return
+	}
 
-📖 Anda juga bisa menggunakan perintah:
-/ulasan [nama lengkap produk] untuk mendapatkan link ulasan produk tersebut.
+	// Tetap menunggu judul lain sampai pengguna mengetik /batal
+	setConversation(ctx.ChatID(), ctx.UserID(), conversation)
+	ctx.reply(ctx.Msg.Text + "\n" + tr(ctx.Lang, "cancel_hint"))
+}
 
-⚠️ Perhatian: Judul harus sesuai, perhatikan huruf besar dan kecilnya agar mendapatkan link ulasan.
+// handleLanguage switches the bot language of the user and reports whether the code was valid.
+// In a group, "grup <code>" sets the default language of the group instead.
+func handleLanguage(ctx *messageContext, code string) bool {
+	code = strings.TrimSpace(code)
+	if fields := strings.Fields(code); ctx.Group != nil && len(fields) == 2 && strings.EqualFold(fields[0], languageGroup) {
+		return handleGroupLanguage(ctx, fields[1])
+	}
 
-📘 Contoh penggunaan:
-/ulasan Ilmu Hacking 
-untuk mendapatkan link ulasan buku Ilmu Hacking.
+	newLang := ""
+	if !strings.EqualFold(code, languageAuto) {
+		newLang = normalizeLanguage(code)
+		if newLang == "" {
+			ctx.reply(tr(ctx.Lang, "language_invalid", code))
+			return false
+		}
+	}
 
-📝 Catatan:
-Kamu juga bisa memberikan ulasan di sini:
-http://aigoretech.rf.gd/kirim-ulasan`
-	case "/ulasan":
-		return "⚠️ Mohon berikan judul lengkap buku untuk mendapatkan link ulasannya.\nContoh penggunaan: /ulasan Judul Buku"
+	updateUserRecord(ctx.UserID(), func(user *datauser.UserData) {
+		user.Language = newLang
+	})
+	if ctx.Group == nil {
+		// Bahasa yang dulu disimpan di chat pribadi digantikan pilihan pengguna
+		updateChatRecord(ctx.ChatID(), func(chat *datauser.ChatData) {
+			chat.Language = ""
+		})
 	}
-	return ""
+	if newLang == "" {
+		ctx.reply(tr(userLanguage(ctx.ChatID(), ctx.UserID(), ctx.Update.Message.From.LanguageCode), "language_auto"))
+	} else {
+		ctx.reply(tr(newLang, "language_set"))
+	}
+	return true
 }
 
-// handle generalmeaasge
-func handleGeneralMessage(update *tgbotapi.Update, bot *tgbotapi.BotAPI, products []Product, reviewLinks []ReviewLink, msg *tgbotapi.MessageConfig, botResponse *string) {
-	if strings.HasPrefix(update.Message.Text, "/ulasan ") {
-		handleReviewLink(update, reviewLinks, botResponse, msg)
+// handleGroupLanguage sets the default language of a group, used for members who didn't pick their own.
+// Only group admins may change it.
+func handleGroupLanguage(ctx *messageContext, code string) bool {
+	if !isGroupAdmin(ctx.Bot.BotAPI, ctx.ChatID(), ctx.Update.Message.From.ID) {
+		ctx.reply(tr(ctx.Lang, "group_admin_only"))
+		return true
+	}
+
+	newLang := ""
+	if !strings.EqualFold(code, languageAuto) {
+		newLang = normalizeLanguage(code)
+		if newLang == "" {
+			ctx.reply(tr(ctx.Lang, "language_invalid", code))
+			return false
+		}
+	}
+
+	updateChatRecord(ctx.ChatID(), func(chat *datauser.ChatData) {
+		chat.Language = newLang
+	})
+	if newLang == "" {
+		ctx.reply(tr(ctx.Lang, "language_auto_group"))
 	} else {
-		handleProductSearch(update, bot, products, botResponse, msg)
+		ctx.reply(tr(newLang, "language_set_group"))
 	}
+	return true
 }
 
-// handle review
-func handleReviewLink(update *tgbotapi.Update, reviewLinks []ReviewLink, botResponse *string, msg *tgbotapi.MessageConfig) {
-	productName := strings.TrimPrefix(update.Message.Text, "/ulasan ")
-	if link, found := findReviewLinkByName(reviewLinks, productName); found {
-		*botResponse = "📘 Link ulasan untuk " + productName + ":\n" + link
-	} else {
-		*botResponse = "⚠️ Link ulasan untuk " + productName + " tidak ditemukan.\nKamu bisa memberikan ulasan di sini: http://aigoretech.rf.gd/kirim-ulasan"
+// continueLanguage answers the language code asked for by a bare /bahasa
+func continueLanguage(ctx *messageContext, conversation *datauser.Conversation) {
+	if handleLanguage(ctx, ctx.Update.Message.Text) {
+		clearConversation(ctx.ChatID(), ctx.UserID())
+		return
 	}
-	msg.Text = *botResponse
+
+	setConversation(ctx.ChatID(), ctx.UserID(), conversation)
+	ctx.reply(ctx.Msg.Text + "\n" + tr(ctx.Lang, "cancel_hint"))
 }
 
 // handle productsearch
-func handleProductSearch(update *tgbotapi.Update, bot *tgbotapi.BotAPI, products []Product, botResponse *string, msg *tgbotapi.MessageConfig) {
-	matchingProducts := findProducts(products, update.Message.Text)
+func handleProductSearch(ctx *messageContext, query string) {
+	if ctx.Group != nil {
+		handleCompactSearch(ctx, query)
+		return
+	}
+
+	matchingProducts, view, ok := searchWithStoreFilter(ctx, query)
+	if !ok {
+		return
+	}
 	if len(matchingProducts) > 0 {
-		var responseBuilder strings.Builder
 		var sentProducts = make(map[string]bool)
+		ratings := loadProductRatings()
 
 		for _, product := range matchingProducts {
 			if _, found := sentProducts[product.Nama]; !found {
-				responseBuilder.WriteString(fmt.Sprintf("📖 Judul: %s\n", product.Nama))
-
-				var buttons []tgbotapi.InlineKeyboardButton
-				for linkName, linkURL := range product.Links {
-					responseBuilder.WriteString(fmt.Sprintf("🔗 [%s](%s)\n", linkName, linkURL))
-					button := tgbotapi.NewInlineKeyboardButtonURL(linkName, linkURL)
-					buttons = append(buttons, button)
-				}
-				responseBuilder.WriteString("\n")
-				keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
-
-				msg.Text = responseBuilder.String()
-				msg.ReplyMarkup = keyboard
-
-				if msg.Text != "" {
-					if _, err := bot.Send(msg); err != nil {
-						logrus.WithFields(logrus.Fields{
-							"error": err,
-						}).Error("Failed to send product message")
-					}
-				} else {
-					logrus.Error("Bot response is empty, not sending message")
+				productMsg := productMessage(ctx.ChatID(), ctx.UserID(), product, ratings, view, ctx.Lang)
+				if _, err := ctx.Bot.sendResults(productMsg, []string{product.Nama}); err != nil {
+					ctx.Log.WithFields(logrus.Fields{
+						"error": err,
+					}).Error("Failed to send product message")
 				}
 
 				sentProducts[product.Nama] = true
-				responseBuilder.Reset() // Reset the builder for the next product
 			}
 		}
+	} else if view.Only != "" {
+		ctx.reply(tr(ctx.Lang, "store_product_missing", view.Only))
 	} else {
-		*botResponse = "⚠️ Produk tidak ditemukan."
-		msg.Text = *botResponse
+		ctx.reply(tr(ctx.Lang, "product_missing"))
 	}
 }
 
-// get ptofile
-func getProfilePhotoURL(bot *tgbotapi.BotAPI, userID int64) string {
-	userProfilePhotos, err := bot.GetUserProfilePhotos(tgbotapi.UserProfilePhotosConfig{UserID: userID})
+// searchWithStoreFilter searches the products matching the query, keeping only those of the store named
+// by a "toko:" filter, and returns how their links are shown. It replies and returns false for an unknown store.
+func searchWithStoreFilter(ctx *messageContext, query string) ([]*Product, storeView, bool) {
+	query, storeName := parseStoreFilter(query)
+	view := storeView{Preferred: userPreferredStore(ctx.ChatID(), ctx.UserID())}
+	if storeName == "" {
+		matchingProducts := timedFindProducts(ctx.Products, query)
+		recordSearch(ctx, query, "", len(matchingProducts))
+		return matchingProducts, view, true
+	}
+
+	store, found := findStore(ctx.Products, storeName)
+	if !found {
+		ctx.reply(tr(ctx.Lang, "store_unknown", storeName, strings.Join(productStores(ctx.Products), ", ")))
+		return nil, view, false
+	}
+	view.Only = store
+	matchingProducts := filterByStore(timedFindProducts(ctx.Products, query), store)
+	recordSearch(ctx, query, store, len(matchingProducts))
+	return matchingProducts, view, true
+}
+
+// timedFindProducts searches the catalog and records the search latency and result count metrics
+func timedFindProducts(products []Product, query string) []*Product {
+	start := time.Now()
+	matchingProducts := findProducts(products, query)
+	metrics.SearchDuration.ObserveSince(start)
+	metrics.SearchResults.Observe(float64(len(matchingProducts)))
+	return matchingProducts
+}
+
+// productMessage builds the search result message of a product with its store and review buttons.
+// Store link clicks are attributed to userID, who may be a member of a group chat.
+func productMessage(chatID, userID int64, product *Product, ratings map[string]productRating, view storeView, lang string) tgbotapi.MessageConfig {
+	var responseBuilder strings.Builder
+	responseBuilder.WriteString(tr(lang, "product_title", product.Nama) + "\n")
+	if rating, found := ratings[product.Nama]; found {
+		responseBuilder.WriteString(formatRating(rating, lang) + "\n")
+	}
+
+	links := trackedLinks(product, productLinks(product, view), userID)
+	for _, link := range links {
+		responseBuilder.WriteString(fmt.Sprintf("🔗 [%s](%s)\n", link.Store, link.URL))
+	}
+	responseBuilder.WriteString("\n")
+	rows := storeButtonRows(links)
+	if product.ReviewLink != "" {
+		reviewButton := tgbotapi.NewInlineKeyboardButtonURL(tr(lang, "review_button"), product.ReviewLink)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(reviewButton))
+	}
+	if rating, found := ratings[product.Nama]; found {
+		userReviewsButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "user_reviews_button", rating.Count), callbackUserReview+productKey(product.Nama))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(userReviewsButton))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, responseBuilder.String())
+	// Pratinjau link akan membuka link /go dan tercatat sebagai klik yang tidak pernah dilakukan pengguna
+	msg.DisableWebPagePreview = true
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	return msg
+}
+
+// getProfilePhotoFileID returns the Telegram file ID of the smallest size of the current profile photo of the user.
+// The file URL is not stored because it contains the bot token; the admin API downloads the photo when it is shown.
+func getProfilePhotoFileID(bot *tgbotapi.BotAPI, userID int64) string {
+	userProfilePhotos, err := bot.GetUserProfilePhotos(tgbotapi.UserProfilePhotosConfig{UserID: userID, Limit: 1})
 	if err != nil {
 		logrus.Error("Failed to get user profile photos:", err)
 		return ""
 	}
 
-	if len(userProfilePhotos.Photos) > 0 {
-		photo := userProfilePhotos.Photos[0][0]
-		fileID := photo.FileID
-		file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
-		if err != nil {
-			logrus.Error("Failed to get file info:", err)
-			return ""
-		}
-		return fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, file.FilePath)
+	if len(userProfilePhotos.Photos) > 0 && len(userProfilePhotos.Photos[0]) > 0 {
+		return userProfilePhotos.Photos[0][0].FileID
 	}
 
 	return ""
 }
 
-func saveUserData(update *tgbotapi.Update, botResponse string, currenttime time.Time, profilePhotoURL string) {
-	filename := "user_data.json"
+// userLanguage returns the language a user is answered in within a chat, see chatLanguage
+func userLanguage(chatID, userID int64, languageCode string) string {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		log.Println("Gagal memuat data pengguna:", err)
+		return detectLanguage(languageCode)
+	}
+	return chatLanguage(db, chatID, userID, languageCode)
+}
+
+// chatLanguage returns the language a user is answered in within a chat from loaded user data: the language
+// the user chose with /bahasa, else the default language of the group set by a group admin, else the one
+// reported by the user's Telegram client
+func chatLanguage(db *datauser.Database, chatID, userID int64, languageCode string) string {
+	if user, found := db.FindUser(userID); found && user.Language != "" {
+		return user.Language
+	}
+	if chat, found := db.FindChat(chatID); found && chat.Language != "" {
+		return chat.Language
+	}
+	return detectLanguage(languageCode)
+}
+
+// updateUserRecord applies fn to the record of the user, creating the record if needed, and saves it
+func updateUserRecord(userID int64, fn func(user *datauser.UserData)) {
+	userDataMu.Lock()
+	defer userDataMu.Unlock()
 
-	users, err := datauser.LoadUserData(filename)
+	db, err := datauser.LoadDatabase(userDataFile)
 	if err != nil {
 		log.Println("Gagal memuat data pengguna:", err)
+		return
 	}
 
-	message := datauser.Message{
-		Content:   update.Message.Text,
+	fn(db.UpsertUser(userID))
+
+	err = datauser.SaveDatabase(userDataFile, db)
+	if err != nil {
+		log.Println("Gagal menyimpan data pengguna:", err)
+	}
+}
+
+// updateChatRecord applies fn to the record of the chat, creating the record if needed, and saves it
+func updateChatRecord(chatID int64, fn func(chat *datauser.ChatData)) {
+	userDataMu.Lock()
+	defer userDataMu.Unlock()
+
+	db, err := datauser.LoadDatabase(userDataFile)
+	if err != nil {
+		log.Println("Gagal memuat data pengguna:", err)
+		return
+	}
+
+	fn(db.UpsertChat(chatID))
+
+	err = datauser.SaveDatabase(userDataFile, db)
+	if err != nil {
+		log.Println("Gagal menyimpan data pengguna:", err)
+	}
+}
+
+// updateProfile refreshes the user record with the profile Telegram sent along with the message
+func updateProfile(user *datauser.UserData, from *tgbotapi.User, profilePhotoFileID string) {
+	user.Username = from.UserName
+	user.FirstName = from.FirstName
+	user.LastName = from.LastName
+	user.LanguageCode = from.LanguageCode
+	if profilePhotoFileID != "" {
+		user.ProfilePhotoFileID = profilePhotoFileID
+	}
+}
+
+// saveUserData stores the message and everything the bot sent in response in the chat history, along with the sender and the chat they wrote in
+func saveUserData(update *tgbotapi.Update, sent []sentMessage, currenttime time.Time, profilePhotoFileID string) {
+	userDataMu.Lock()
+	defer userDataMu.Unlock()
+
+	filename := userDataFile
+
+	db, err := datauser.LoadDatabase(filename)
+	if err != nil {
+		// Jangan menimpa file yang gagal dibaca
+		log.Println("Gagal memuat data pengguna:", err)
+		return
+	}
+
+	message := update.Message
+	chat := db.UpsertChat(message.Chat.ID)
+	chat.Type = message.Chat.Type
+	chat.Title = message.Chat.Title
+
+	var userID int64
+	if message.From != nil {
+		userID = message.From.ID
+		updateProfile(db.UpsertUser(userID), message.From, profilePhotoFileID)
+	}
+
+	userMessage := datauser.Message{
+		Content:   message.Text,
 		Sender:    "user",
+		UserID:    userID,
 		Timestamp: currenttime,
 	}
+	db.AddMessage(message.Chat.ID, userMessage)
+	publishDashboardMessage(db, message.Chat.ID, userMessage)
+	addSentMessages(db, sent)
 
-	updatedUsers, err := datauser.AddUserMessage(users, update.Message.Chat.ID, message)
+	err = datauser.SaveDatabase(filename, db)
 	if err != nil {
-		// Jika pengguna baru, tambahkan data pengguna baru
-		newUser := datauser.UserData{
-			ID:              update.Message.Chat.ID,
-			Username:        update.Message.From.UserName,
-			FirstName:       update.Message.From.FirstName,
-			LastName:        update.Message.From.LastName,
-			ProfilePhotoURL: profilePhotoURL,
-			Messages:        []datauser.Message{message},
-		}
-		updatedUsers = append(users, newUser)
+		log.Println("Gagal menyimpan data pengguna:", err)
 	}
 
-	botMessage := datauser.Message{
-		Content:   botResponse,
-		Sender:    "bot",
-		Timestamp: currenttime,
+	err = datauser.SaveUserDataToHTML(db, userDataHTMLFile)
+	if err != nil {
+		log.Println("Gagal menyimpan data pengguna ke HTML:", err)
+	}
+}
+
+// saveBotMessages stores messages the bot sent outside of an answer to a message, e.g. after a button press
+func saveBotMessages(sent []sentMessage) {
+	if len(sent) == 0 {
+		return
 	}
 
-	updatedUsers, err = datauser.AddUserMessage(updatedUsers, update.Message.Chat.ID, botMessage)
+	userDataMu.Lock()
+	defer userDataMu.Unlock()
+
+	db, err := datauser.LoadDatabase(userDataFile)
 	if err != nil {
-		log.Println("Gagal menambahkan pesan bot ke data pengguna:", err)
+		log.Println("Gagal memuat data pengguna:", err)
+		return
 	}
 
-	err = datauser.SaveUserData(filename, updatedUsers)
+	addSentMessages(db, sent)
+
+	err = datauser.SaveDatabase(userDataFile, db)
 	if err != nil {
 		log.Println("Gagal menyimpan data pengguna:", err)
 	}
 
-	err = datauser.SaveUserDataToHTML(updatedUsers, "user_data.html")
+	err = datauser.SaveUserDataToHTML(db, userDataHTMLFile)
 	if err != nil {
 		log.Println("Gagal menyimpan data pengguna ke HTML:", err)
 	}
 }
+
+// addSentMessages adds bot messages to the history of the chats they were sent to and to the live dashboard feed
+func addSentMessages(db *datauser.Database, sent []sentMessage) {
+	for _, s := range sent {
+		chat := db.UpsertChat(s.ChatID)
+		// Pesan ke chat yang belum dikenal, misalnya notifikasi ke admin, selalu dikirim ke chat pribadi
+		if chat.Type == "" && s.ChatID > 0 {
+			chat.Type = datauser.ChatPrivate
+		}
+		db.AddMessage(s.ChatID, s.Message)
+		publishDashboardMessage(db, s.ChatID, s.Message)
+	}
+}
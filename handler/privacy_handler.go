@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"encoding/json"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// userDataHTMLFile is the dashboard page rendered from the user data
+const userDataHTMLFile = "user_data.html"
+
+// userExport is everything stored about a user, sent by /datasaya
+type userExport struct {
+	ExportedAt  time.Time             `json:"exported_at"`
+	User        *datauser.UserData    `json:"user"`
+	Memberships []datauser.Membership `json:"memberships"`
+	Chat        *datauser.ChatData    `json:"chat"`
+	// GroupMessages are the messages the user wrote in group chats, by chat ID
+	GroupMessages map[int64][]datauser.Message `json:"group_messages"`
+	Reviews       []UserReview                 `json:"reviews"`
+	Searches      []SearchEvent                `json:"searches"`
+	Clicks        []Click                      `json:"clicks"`
+	Broadcasts    []receivedBroadcast          `json:"broadcasts"`
+}
+
+// receivedBroadcast is a broadcast sent to the user, with its delivery status
+type receivedBroadcast struct {
+	BroadcastID int64  `json:"broadcast_id"`
+	Text        string `json:"text"`
+	BroadcastRecipient
+}
+
+// collectUserData gathers the records of a user from every store
+func collectUserData(userID int64) (userExport, error) {
+	export := userExport{
+		ExportedAt:    time.Now(),
+		Memberships:   []datauser.Membership{},
+		GroupMessages: map[int64][]datauser.Message{},
+		Reviews:       []UserReview{},
+		Searches:      []SearchEvent{},
+		Clicks:        []Click{},
+		Broadcasts:    []receivedBroadcast{},
+	}
+
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		return export, err
+	}
+	if user, found := db.FindUser(userID); found {
+		export.User = user
+	}
+	export.Memberships = append(export.Memberships, db.UserMemberships(userID)...)
+	for i := range db.Chats {
+		chat := &db.Chats[i]
+		if chat.ID == userID {
+			export.Chat = chat
+			continue
+		}
+		for _, message := range chat.Messages {
+			if message.UserID == userID {
+				export.GroupMessages[chat.ID] = append(export.GroupMessages[chat.ID], message)
+			}
+		}
+	}
+
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	userReviewsMu.Unlock()
+	if err != nil {
+		return export, err
+	}
+	for _, review := range reviews {
+		if review.UserID == userID {
+			export.Reviews = append(export.Reviews, review)
+		}
+	}
+
+	searchEventsMu.Lock()
+	events, err := loadSearchEvents(searchEventsFile)
+	searchEventsMu.Unlock()
+	if err != nil {
+		return export, err
+	}
+	for _, event := range events {
+		if event.UserID == userID {
+			export.Searches = append(export.Searches, event)
+		}
+	}
+
+	clicksMu.Lock()
+	clicks, err := loadClicks(clicksFile)
+	clicksMu.Unlock()
+	if err != nil {
+		return export, err
+	}
+	for _, click := range clicks {
+		if click.UserID == userID {
+			export.Clicks = append(export.Clicks, click)
+		}
+	}
+
+	broadcastsMu.Lock()
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	broadcastsMu.Unlock()
+	if err != nil {
+		return export, err
+	}
+	for _, broadcast := range broadcasts {
+		for _, recipient := range broadcast.Recipients {
+			if recipient.UserID == userID {
+				export.Broadcasts = append(export.Broadcasts, receivedBroadcast{BroadcastID: broadcast.ID, Text: broadcast.Text, BroadcastRecipient: recipient})
+			}
+		}
+	}
+	return export, nil
+}
+
+// deleteUserData erases a user from every store and renders the dashboard again without them
+func deleteUserData(userID int64) error {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	if err == nil {
+		if user, found := db.FindUser(userID); found && user.Unsubscribed {
+			// Simpan hanya hash ID agar pengguna tetap tidak menerima broadcast setelah datanya dihapus
+			err = setBroadcastOptOut(userID, true)
+		}
+	}
+	if err == nil {
+		db.DeleteUser(userID)
+		err = datauser.SaveDatabase(userDataFile, db)
+	}
+	if err == nil {
+		err = datauser.SaveUserDataToHTML(db, userDataHTMLFile)
+	}
+	userDataMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	if err == nil {
+		kept := reviews[:0]
+		for _, review := range reviews {
+			if review.UserID != userID {
+				kept = append(kept, review)
+			}
+		}
+		err = saveUserReviews(userReviewsFile, kept)
+	}
+	userReviewsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	searchEventsMu.Lock()
+	events, err := loadSearchEvents(searchEventsFile)
+	if err == nil {
+		kept := events[:0]
+		for _, event := range events {
+			if event.UserID != userID {
+				kept = append(kept, event)
+			}
+		}
+		err = saveSearchEvents(searchEventsFile, kept)
+	}
+	searchEventsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	clicksMu.Lock()
+	clicks, err := loadClicks(clicksFile)
+	if err == nil {
+		kept := clicks[:0]
+		for _, click := range clicks {
+			if click.UserID != userID {
+				kept = append(kept, click)
+			}
+		}
+		err = saveClicks(clicksFile, kept)
+	}
+	clicksMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+	broadcasts, err := loadBroadcasts(broadcastsFile)
+	if err != nil {
+		return err
+	}
+	for i := range broadcasts {
+		kept := broadcasts[i].Recipients[:0]
+		for _, recipient := range broadcasts[i].Recipients {
+			if recipient.UserID != userID {
+				kept = append(kept, recipient)
+			}
+		}
+		broadcasts[i].Recipients = kept
+	}
+	return saveBroadcasts(broadcastsFile, broadcasts)
+}
+
+// handleDataExport sends the user a JSON file with everything stored about them on /datasaya
+func handleDataExport(ctx *messageContext) {
+	if ctx.Group != nil {
+		ctx.reply(tr(ctx.Lang, "private_only"))
+		return
+	}
+
+	userID := ctx.Update.Message.From.ID
+	export, err := collectUserData(userID)
+	if err != nil {
+		ctx.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to collect user data")
+		ctx.reply(tr(ctx.Lang, "data_export_failed"))
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		ctx.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to marshal user data export")
+		ctx.reply(tr(ctx.Lang, "data_export_failed"))
+		return
+	}
+
+	document := tgbotapi.NewDocument(ctx.ChatID(), tgbotapi.FileBytes{Name: "datasaya.json", Bytes: data})
+	document.Caption = tr(ctx.Lang, "data_export_caption")
+	if _, err := ctx.Bot.Send(document); err != nil {
+		ctx.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to send data export")
+		ctx.reply(tr(ctx.Lang, "data_export_failed"))
+		return
+	}
+}
+
+// handleDataDeletion asks the user to confirm the erasure of their data on /hapusdata
+func handleDataDeletion(ctx *messageContext) {
+	if ctx.Group != nil {
+		ctx.reply(tr(ctx.Lang, "private_only"))
+		return
+	}
+
+	ctx.reply(tr(ctx.Lang, "data_delete_confirm"))
+	ctx.Msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(ctx.Lang, "data_delete_yes"), callbackDeleteData+"yes"),
+		tgbotapi.NewInlineKeyboardButtonData(tr(ctx.Lang, "data_delete_no"), callbackDeleteData+"no"),
+	))
+}
+
+// handleDeleteDataCallback erases the data of the user once they confirm, and replaces the confirmation with the outcome
+func handleDeleteDataCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, lang string) {
+	// Hanya pemilik data yang boleh menghapusnya, dan hanya dari chat pribadinya
+	if query.Message.Chat.ID != query.From.ID {
+		return
+	}
+
+	text := tr(lang, "data_delete_cancelled")
+	deleted := false
+	if data == "yes" {
+		if err := deleteUserData(query.From.ID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"user_id_hash": hashID(query.From.ID),
+				"error":        err,
+			}).Error("Failed to delete user data")
+			text = tr(lang, "data_delete_failed")
+		} else {
+			text = tr(lang, "data_deleted")
+			deleted = true
+		}
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	send := bot.Send
+	if deleted {
+		// Jangan catat pesan hasil penghapusan, karena mencatatnya membuat ulang chat yang baru dihapus
+		send = bot.BotAPI.Send
+	}
+	if _, err := send(edit); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to update data deletion message")
+	}
+}
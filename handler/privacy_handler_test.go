@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newTestBot returns a bot talking to a fake Telegram Bot API that accepts every message.
+// onRequest, if not nil, is called with every request but getMe.
+func newTestBot(t *testing.T, onRequest func(r *http.Request)) *tgbotapi.BotAPI {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"BookFinderBot"}}`))
+			return
+		}
+		if onRequest != nil {
+			onRequest(r)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+func TestDeleteUserDataErasesEveryMessageAboutTheUser(t *testing.T) {
+	chdirTemp(t)
+	const (
+		userID  = int64(987654321)
+		otherID = int64(555000111)
+		adminID = int64(111222333)
+		groupID = int64(-100444555666)
+	)
+	t.Setenv("ADMIN_IDS", "111222333")
+	now := time.Now()
+
+	db := &datauser.Database{}
+	db.UpsertUser(userID).Username = "pengulas_rahasia"
+	db.UpsertUser(otherID).Username = "anggota_lain"
+	db.UpsertChat(userID).Type = datauser.ChatPrivate
+	db.UpsertChat(groupID).Type = datauser.ChatGroup
+	db.AddMessage(userID, datauser.Message{Content: "/beriulasan", Sender: "user", UserID: userID, Timestamp: now})
+	db.AddMessage(groupID, datauser.Message{Content: "python", Sender: "user", UserID: userID, Timestamp: now})
+	db.AddMessage(groupID, datauser.Message{Content: "golang", Sender: "user", UserID: otherID, Timestamp: now})
+	if err := datauser.SaveDatabase(userDataFile, db); err != nil {
+		t.Fatal(err)
+	}
+
+	bot := newTestBot(t, nil)
+	// Hasil pencarian pengguna di grup (lebih dari satu pesan) dan notifikasi ulasannya ke admin
+	out := newSender(bot, userID)
+	out.Send(tgbotapi.NewMessage(groupID, "📖 Judul: Belajar Python"))
+	out.Send(tgbotapi.NewMessage(groupID, "📖 Judul: Python Lanjutan"))
+	notifyAdminsOfReview(out, UserReview{
+		ID: 1, ProductName: "Belajar Python", UserID: userID, Username: "pengulas_rahasia",
+		Rating: 5, Text: "Bagus sekali", Status: ReviewPending, CreatedAt: now,
+	})
+	saveBotMessages(out.sent)
+
+	// Balasan untuk anggota lain harus tetap tersimpan
+	other := newSender(bot, otherID)
+	other.Send(tgbotapi.NewMessage(groupID, "📖 Judul: Belajar Go"))
+	saveBotMessages(other.sent)
+
+	if err := deleteUserData(userID); err != nil {
+		t.Fatalf("deleteUserData: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(userDataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"987654321", "pengulas_rahasia", "Bagus sekali", "Python"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("user_data.json still contains %q after deletion", leaked)
+		}
+	}
+
+	db, err = datauser.LoadDatabase(userDataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, found := db.FindChat(groupID)
+	if !found || len(group.Messages) != 2 {
+		t.Fatalf("group messages = %+v, want the message of the other member and its reply", group)
+	}
+	if _, found := db.FindUser(otherID); !found {
+		t.Error("the other member was deleted")
+	}
+}
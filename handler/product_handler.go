@@ -6,22 +6,50 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/1amkaizen/BookFinderBot/metrics"
 	"github.com/jdkato/prose/v2"
 )
 
-// ANSI escape codes for coloring
-const (
-	Reset = "\033[0m"
-	Green = "\033[32m"
-)
-
 // Product represents a product with multiple affiliate links
 type Product struct {
-	Nama  string            `json:"name"`
-	Links map[string]string `json:"links"`
+	Nama       string      `json:"name"`
+	Category   string      `json:"category,omitempty"`
+	Links      []StoreLink `json:"links"`
+	ReviewLink string      `json:"review_link,omitempty"`
+}
+
+// StoreLink is the affiliate link of a product at one store
+type StoreLink struct {
+	Store string `json:"store"`
+	URL   string `json:"url"`
+}
+
+// Link returns the link of the product at the store
+func (p *Product) Link(store string) (string, bool) {
+	for _, link := range p.Links {
+		if link.Store == store {
+			return link.URL, true
+		}
+	}
+	return "", false
 }
 
+// setLink sets the link of the product at the store, keeping the position of an existing link
+func (p *Product) setLink(store, url string) {
+	for i := range p.Links {
+		if p.Links[i].Store == store {
+			p.Links[i].URL = url
+			return
+		}
+	}
+	p.Links = append(p.Links, StoreLink{Store: store, URL: url})
+}
+
+// categoryKeys are the catalog file keys that set the category of a product instead of a link
+var categoryKeys = map[string]bool{"kategori": true, "category": true}
+
 // loadProductsFromTxt reads and parses the text file containing product data
 func loadProductsFromTxt(filename string) ([]Product, error) {
 	file, err := os.Open(filename)
@@ -42,12 +70,14 @@ func loadProductsFromTxt(filename string) ([]Product, error) {
 			}
 			continue
 		}
-		if strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if currentProduct.Links == nil {
-				currentProduct.Links = make(map[string]string)
-			}
-			currentProduct.Links[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && categoryKeys[strings.ToLower(strings.TrimSpace(parts[0]))] {
+			currentProduct.Category = strings.TrimSpace(parts[1])
+			continue
+		}
+		// Judul seperti "Data Mining: Teori dan Aplikasi" juga mengandung ":", link selalu berupa URL
+		if len(parts) == 2 && isStoreURL(strings.TrimSpace(parts[1])) {
+			currentProduct.setLink(normalizeStoreName(parts[0]), strings.TrimSpace(parts[1]))
 		} else {
 			currentProduct.Nama = line
 		}
@@ -63,6 +93,7 @@ func loadProductsFromTxt(filename string) ([]Product, error) {
 
 // saveProductsToJson saves the products list to a JSON file
 func saveProductsToJson(products []Product, filename string) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
 	data, err := json.MarshalIndent(products, "", "  ")
 	if err != nil {
 		return err
@@ -90,44 +121,13 @@ func extractEntities(message string) []string {
 }
 
 func findProducts(products []Product, message string) []*Product {
-	message = strings.ToLower(message)
 	var matchingProducts []*Product
 
-	if len(message) < 2 {
-		return matchingProducts
-	}
-
-	// Tokenisasi pesan menggunakan NLP
-	keywords := tokenize(message)
-
-	// Simpan kata kunci yang unik
-	uniqueKeywords := make(map[string]bool)
-	for _, keyword := range keywords {
-		uniqueKeywords[keyword] = true
-	}
-
 	// Cari produk yang cocok berdasarkan kata kunci dalam nama produk
-	for i := range products {
-		productName := strings.ToLower(products[i].Nama)
-		if matchKeywords(productName, uniqueKeywords) {
-			matchingProducts = append(matchingProducts, &products[i])
-		}
+	matches := searchNames(len(products), func(i int) string { return products[i].Nama }, message)
+	for _, match := range matches {
+		matchingProducts = append(matchingProducts, &products[match.Index])
 	}
 
 	return matchingProducts
 }
-
-// Tokenisasi menggunakan pemisah kata sederhana
-func tokenize(message string) []string {
-	return strings.Fields(message)
-}
-
-// Cocokkan kata kunci dalam nama produk
-func matchKeywords(productName string, keywords map[string]bool) bool {
-	for keyword := range keywords {
-		if strings.Contains(productName, keyword) {
-			return true
-		}
-	}
-	return false
-}
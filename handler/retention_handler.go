@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	"github.com/sirupsen/logrus"
+)
+
+// Default retention of the raw messages in the user data file, the search events and the clicks
+const (
+	defaultRetentionDays        = 90
+	defaultRetentionMaxMessages = 200
+	defaultCompactionInterval   = time.Hour
+)
+
+// retentionPolicy reads the retention policy from RETENTION_DAYS and RETENTION_MAX_MESSAGES,
+// where 0 disables the limit
+func retentionPolicy() datauser.RetentionPolicy {
+	days := envInt("RETENTION_DAYS", defaultRetentionDays)
+	return datauser.RetentionPolicy{
+		MaxAge:      time.Duration(days) * 24 * time.Hour,
+		MaxMessages: envInt("RETENTION_MAX_MESSAGES", defaultRetentionMaxMessages),
+	}
+}
+
+// envInt reads a non-negative integer environment variable, falling back to def when unset or invalid
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logrus.WithFields(logrus.Fields{
+			"variable": name,
+			"value":    value,
+		}).Warn("Invalid number in environment variable, using the default")
+		return def
+	}
+	return n
+}
+
+// purgeOldEvents removes the search events and clicks older than maxAge, which hold user IDs and queries,
+// and returns how many were removed
+func purgeOldEvents(maxAge time.Duration, now time.Time) (int, error) {
+	if maxAge <= 0 {
+		return 0, nil
+	}
+	purged := 0
+
+	searchEventsMu.Lock()
+	events, err := loadSearchEvents(searchEventsFile)
+	if err == nil {
+		kept := events[:0]
+		for _, event := range events {
+			if now.Sub(event.Timestamp) <= maxAge {
+				kept = append(kept, event)
+			}
+		}
+		if len(kept) < len(events) {
+			purged += len(events) - len(kept)
+			err = saveSearchEvents(searchEventsFile, kept)
+		}
+	}
+	searchEventsMu.Unlock()
+	if err != nil {
+		return purged, err
+	}
+
+	clicksMu.Lock()
+	defer clicksMu.Unlock()
+	clicks, err := loadClicks(clicksFile)
+	if err != nil {
+		return purged, err
+	}
+	kept := clicks[:0]
+	for _, click := range clicks {
+		if now.Sub(click.Timestamp) <= maxAge {
+			kept = append(kept, click)
+		}
+	}
+	if len(kept) == len(clicks) {
+		return purged, nil
+	}
+	purged += len(clicks) - len(kept)
+	return purged, saveClicks(clicksFile, kept)
+}
+
+// startEventRetention purges the old search events and clicks now and then every interval in the background.
+// Calling the returned function stops the job.
+func startEventRetention(maxAge time.Duration, interval time.Duration) func() {
+	stop := make(chan struct{})
+	purge := func() {
+		purged, err := purgeOldEvents(maxAge, time.Now())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to purge old search events and clicks")
+			return
+		}
+		if purged > 0 {
+			logrus.WithFields(logrus.Fields{
+				"purged": purged,
+			}).Info("Old search events and clicks purged")
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		purge()
+		for {
+			select {
+			case <-ticker.C:
+				purge()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// StartRetention starts the background jobs purging old messages from the user data file and old search events
+// and clicks, every COMPACTION_INTERVAL (a Go duration such as 30m, 1h by default)
+func StartRetention() func() {
+	interval := defaultCompactionInterval
+	if value := os.Getenv("COMPACTION_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			logrus.WithFields(logrus.Fields{
+				"value": value,
+			}).Warn("Invalid COMPACTION_INTERVAL, using the default")
+		} else {
+			interval = parsed
+		}
+	}
+
+	policy := retentionPolicy()
+	logrus.WithFields(logrus.Fields{
+		"max_age":      policy.MaxAge.String(),
+		"max_messages": policy.MaxMessages,
+		"interval":     interval.String(),
+	}).Info("Starting user data retention")
+
+	stopCompaction := datauser.StartCompaction(userDataFile, policy, interval, &userDataMu, func(db *datauser.Database) {
+		// Dashboard juga tidak boleh lagi menampilkan pesan yang sudah dihapus
+		if err := datauser.SaveUserDataToHTML(db, userDataHTMLFile); err != nil {
+			log.Println("Gagal menyimpan data pengguna ke HTML:", err)
+		}
+	})
+	// search_events.json dan clicks.json juga berisi ID pengguna dan kueri, jadi ikut umur maksimum yang sama
+	stopEvents := startEventRetention(policy.MaxAge, interval)
+	return func() {
+		stopCompaction()
+		stopEvents()
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeOldEvents(t *testing.T) {
+	chdirTemp(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-100 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	if err := saveSearchEvents(searchEventsFile, []SearchEvent{
+		{UserID: 1, Query: "lama", Timestamp: old},
+		{UserID: 2, Query: "baru", Timestamp: recent},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveClicks(clicksFile, []Click{
+		{UserID: 1, Product: "Lama", Timestamp: old},
+		{UserID: 2, Product: "Baru", Timestamp: recent},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := purgeOldEvents(90*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("purged = %d, want 2", purged)
+	}
+
+	events, err := loadSearchEvents(searchEventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Query != "baru" {
+		t.Errorf("events = %+v, want only the recent search", events)
+	}
+	clicks, err := loadClicks(clicksFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clicks) != 1 || clicks[0].Product != "Baru" {
+		t.Errorf("clicks = %+v, want only the recent click", clicks)
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	"github.com/sirupsen/logrus"
 )
 
 // ReviewLink represents a review link for a product
@@ -47,6 +51,7 @@ func loadReviewLinksFromTxt(filename string) ([]ReviewLink, error) {
 
 // saveReviewLinksToJson saves the review links to a JSON file
 func saveReviewLinksToJson(reviewLinks []ReviewLink, filename string) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
 	data, err := json.MarshalIndent(reviewLinks, "", "  ")
 	if err != nil {
 		return err
@@ -54,12 +59,61 @@ func saveReviewLinksToJson(reviewLinks []ReviewLink, filename string) error {
 	return ioutil.WriteFile(filename, data, 0644)
 }
 
-// findReviewLinkByName searches for review link based on product name
-func findReviewLinkByName(reviewLinks []ReviewLink, productName string) (string, bool) {
-	for _, link := range reviewLinks {
-		if link.ProductName == productName {
-			return link.Link, true
+// findReviewLinks searches the reviewed products matching the given title and returns their
+// indexes in reviewLinks. Only the best scoring matches are kept, so an exact title yields a single result.
+func findReviewLinks(reviewLinks []ReviewLink, productName string) []int {
+	var reviewed []searchMatch
+	matches := searchNames(len(reviewLinks), func(i int) string { return reviewLinks[i].ProductName }, productName)
+	for _, match := range matches {
+		if reviewLinks[match.Index].Link != "" {
+			reviewed = append(reviewed, match)
+		}
+	}
+
+	var found []int
+	for _, match := range bestMatches(reviewed) {
+		found = append(found, match.Index)
+	}
+	return found
+}
+
+// joinReviewLinks attaches each review link to the catalog product with the same title.
+// It returns the review entries that don't correspond to any product.
+func joinReviewLinks(products []Product, reviewLinks []ReviewLink) []ReviewLink {
+	productIndex := make(map[string]int)
+	for i := range products {
+		productIndex[normalizeText(products[i].Nama)] = i
+	}
+
+	var unmatched []ReviewLink
+	for _, reviewLink := range reviewLinks {
+		if !isReviewURL(reviewLink.Link) {
+			continue
+		}
+		i, found := productIndex[normalizeText(reviewLink.ProductName)]
+		if !found {
+			unmatched = append(unmatched, reviewLink)
+			continue
 		}
+		products[i].ReviewLink = reviewLink.Link
 	}
-	return "", false
+	return unmatched
+}
+
+// reportUnmatchedReviewLinks logs the review entries that have no matching catalog product
+func reportUnmatchedReviewLinks(unmatched []ReviewLink) {
+	for _, reviewLink := range unmatched {
+		logrus.WithFields(logrus.Fields{
+			"product": reviewLink.ProductName,
+			"link":    reviewLink.Link,
+		}).Warn("Review link does not match any catalog product")
+	}
+	if len(unmatched) > 0 {
+		logrus.Warnf("%d review link(s) do not match any catalog product", len(unmatched))
+	}
+}
+
+// isReviewURL reports whether link looks like a usable review URL
+func isReviewURL(link string) bool {
+	return strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")
 }
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores given by searchScore, higher is a better match
+const (
+	scoreExact       = 100
+	scorePhrase      = 75
+	scoreAllKeywords = 50
+	scoreAnyKeyword  = 10
+)
+
+// accentFolds maps accented latin letters to their plain form
+var accentFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+	'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'ý': "y", 'ÿ': "y",
+	'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+// searchMatch is a search hit, pointing at the index of the matched item
+type searchMatch struct {
+	Index int
+	Score int
+}
+
+// normalizeText lowercases s, strips accents and replaces punctuation with spaces
+// so that "Kitab-Hacker!" and "kitab hacker" compare equal
+func normalizeText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := accentFolds[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// searchScore rates how well name matches the normalized query and its keywords, 0 means no match
+func searchScore(name, query string, keywords []string) int {
+	name = normalizeText(name)
+	if name == query {
+		return scoreExact
+	}
+	if strings.Contains(name, query) {
+		return scorePhrase
+	}
+
+	matched := 0
+	for _, keyword := range keywords {
+		if strings.Contains(name, keyword) {
+			matched++
+		}
+	}
+	switch {
+	case matched == 0:
+		return 0
+	case matched == len(keywords):
+		return scoreAllKeywords
+	default:
+		return scoreAnyKeyword
+	}
+}
+
+// searchNames runs query against count names provided by name and returns the hits, best first.
+// Items with the same score keep their original order.
+func searchNames(count int, name func(i int) string, query string) []searchMatch {
+	query = normalizeText(query)
+	if len(query) < 2 {
+		return nil
+	}
+
+	// Simpan kata kunci yang unik
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, keyword := range tokenize(query) {
+		if !seen[keyword] {
+			seen[keyword] = true
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	var matches []searchMatch
+	for i := 0; i < count; i++ {
+		if score := searchScore(name(i), query, keywords); score > 0 {
+			matches = append(matches, searchMatch{Index: i, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].Score > matches[b].Score
+	})
+	return matches
+}
+
+// bestMatches keeps only the hits that share the top score
+func bestMatches(matches []searchMatch) []searchMatch {
+	if len(matches) == 0 {
+		return matches
+	}
+	for i := range matches {
+		if matches[i].Score < matches[0].Score {
+			return matches[:i]
+		}
+	}
+	return matches
+}
+
+// Tokenisasi menggunakan pemisah kata sederhana
+func tokenize(message string) []string {
+	return strings.Fields(message)
+}
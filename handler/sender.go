@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"time"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sentMessage is a message the bot sent, waiting to be stored in the history of its chat
+type sentMessage struct {
+	ChatID  int64
+	Message datauser.Message
+}
+
+// sender sends messages through the bot and records every message that was delivered,
+// so the conversation history shows what the user actually received
+type sender struct {
+	*tgbotapi.BotAPI
+	sent []sentMessage
+	// about is the user whose update is handled. Recorded messages are tagged with it, so they are erased
+	// with the data of that user wherever they were sent.
+	about int64
+}
+
+// newSender wraps the bot for the handling of an update of the given user, 0 if the messages concern no
+// user in particular. It is not safe for concurrent use.
+func newSender(bot *tgbotapi.BotAPI, about int64) *sender {
+	return &sender{BotAPI: bot, about: about}
+}
+
+// Send sends a message and records it
+func (s *sender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return s.send(c, nil, s.about)
+}
+
+// sendAbout sends a message concerning another user than the one whose update is handled, e.g. a review
+// shown to the admins, and records it tagged with that user
+func (s *sender) sendAbout(c tgbotapi.Chattable, userID int64) (tgbotapi.Message, error) {
+	return s.send(c, nil, userID)
+}
+
+// sendResults sends a message showing the given products and records it along with them
+func (s *sender) sendResults(c tgbotapi.Chattable, products []string) (tgbotapi.Message, error) {
+	return s.send(c, products, s.about)
+}
+
+// send sends a message and records it with the products it shows and the user it concerns
+func (s *sender) send(c tgbotapi.Chattable, products []string, about int64) (tgbotapi.Message, error) {
+	response, err := s.BotAPI.Send(c)
+	if err != nil {
+		return response, err
+	}
+
+	chatID, message, ok := outgoingMessage(c)
+	if ok {
+		message.MessageID = response.MessageID
+		message.Products = products
+		message.AboutUserID = about
+		message.Timestamp = time.Now()
+		s.sent = append(s.sent, sentMessage{ChatID: chatID, Message: message})
+	}
+	return response, nil
+}
+
+// outgoingMessage describes a message config as it is stored in the history. Configs that don't
+// send or change a message, like chat actions, are not recorded.
+func outgoingMessage(c tgbotapi.Chattable) (int64, datauser.Message, bool) {
+	message := datauser.Message{Sender: "bot"}
+	switch config := c.(type) {
+	case tgbotapi.MessageConfig:
+		message.Content = config.Text
+		message.Buttons = keyboardButtons(config.ReplyMarkup)
+		return config.ChatID, message, true
+	case tgbotapi.DocumentConfig:
+		message.Content = config.Caption
+		message.Kind = datauser.KindDocument
+		message.Buttons = keyboardButtons(config.ReplyMarkup)
+		return config.ChatID, message, true
+	case tgbotapi.EditMessageTextConfig:
+		message.Content = config.Text
+		message.Kind = datauser.KindEdit
+		if config.ReplyMarkup != nil {
+			message.Buttons = keyboardButtons(*config.ReplyMarkup)
+		}
+		return config.ChatID, message, true
+	}
+	return 0, message, false
+}
+
+// keyboardButtons lists the buttons of an inline keyboard, nil for any other reply markup
+func keyboardButtons(markup interface{}) []datauser.Button {
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch m := markup.(type) {
+	case tgbotapi.InlineKeyboardMarkup:
+		keyboard = m
+	case *tgbotapi.InlineKeyboardMarkup:
+		if m == nil {
+			return nil
+		}
+		keyboard = *m
+	default:
+		return nil
+	}
+
+	var buttons []datauser.Button
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			b := datauser.Button{Text: button.Text}
+			if button.URL != nil {
+				b.URL = *button.URL
+			}
+			if button.CallbackData != nil {
+				b.Data = *button.CallbackData
+			}
+			buttons = append(buttons, b)
+		}
+	}
+	return buttons
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// storeFilterPrefixes start a query token restricting the results to one store, as in "python toko:gramedia"
+var storeFilterPrefixes = []string{"toko:", "store:"}
+
+// storeAliases maps the normalized spellings found in the catalog and typed by users to the canonical store name
+var storeAliases = map[string]string{
+	"gramedia":  "Gramedia",
+	"gramed":    "Gramedia",
+	"tokopedia": "Tokopedia",
+	"tokooedia": "Tokopedia",
+	"tokped":    "Tokopedia",
+	"shopee":    "Shopee",
+	"shoppe":    "Shopee",
+	"shope":     "Shopee",
+}
+
+// defaultStorePriority is the order of the store links when STORE_PRIORITY is not set.
+// Stores missing from the list come after the listed ones, in catalog order.
+var defaultStorePriority = []string{"Gramedia", "Tokopedia", "Shopee"}
+
+// storeButtonsPerRow is the number of store buttons in each row of a result keyboard
+const storeButtonsPerRow = 2
+
+// storeAll is the /toko argument that clears the preferred store
+const storeAll = "semua"
+
+// storeGroup starts the /toko arguments setting the default store of a group, as in "/toko grup gramedia"
+const storeGroup = "grup"
+
+// storeView tells how the store links of a result are shown:
+// Only keeps the links of one store, Preferred lists the links of one store first
+type storeView struct {
+	Only      string
+	Preferred string
+}
+
+// normalizeStoreName returns the canonical name of a store, so "tokopedia", "Tokooedia" and "TOKOPEDIA" are the same store
+func normalizeStoreName(name string) string {
+	key := strings.ReplaceAll(normalizeText(name), " ", "")
+	if store, found := storeAliases[key]; found {
+		return store
+	}
+	return strings.TrimSpace(name)
+}
+
+// storePriority returns the store order set in the STORE_PRIORITY environment variable (comma separated),
+// or the default order
+func storePriority() []string {
+	var stores []string
+	for _, field := range strings.Split(os.Getenv("STORE_PRIORITY"), ",") {
+		if strings.TrimSpace(field) != "" {
+			stores = append(stores, normalizeStoreName(field))
+		}
+	}
+	if len(stores) == 0 {
+		return defaultStorePriority
+	}
+	return stores
+}
+
+// storeRank returns the position of a store in the link order, the preferred store of the user comes first
+func storeRank(store string, priority []string, preferred string) int {
+	if store == preferred {
+		return 0
+	}
+	for i, prioritized := range priority {
+		if prioritized == store {
+			return i + 1
+		}
+	}
+	return len(priority) + 1
+}
+
+// findStore resolves a store typed by a user against the stores of the catalog
+func findStore(products []Product, name string) (string, bool) {
+	store := normalizeStoreName(name)
+	for _, known := range productStores(products) {
+		if strings.EqualFold(known, store) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// productStores lists the stores found in the catalog in link order
+func productStores(products []Product) []string {
+	seen := make(map[string]bool)
+	var stores []string
+	for _, product := range products {
+		for _, link := range product.Links {
+			if !seen[link.Store] {
+				seen[link.Store] = true
+				stores = append(stores, link.Store)
+			}
+		}
+	}
+	priority := storePriority()
+	sort.SliceStable(stores, func(a, b int) bool {
+		return storeRank(stores[a], priority, "") < storeRank(stores[b], priority, "")
+	})
+	return stores
+}
+
+// parseStoreFilter splits a "toko:<nama>" token off a search query, also when a space follows the colon
+// as in "toko: gramedia". It returns the rest of the query and the store name as typed, empty if the query
+// has no filter.
+func parseStoreFilter(query string) (string, string) {
+	var kept []string
+	store := ""
+	fields := strings.Fields(query)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		lower := strings.ToLower(field)
+		matched := false
+		for _, prefix := range storeFilterPrefixes {
+			if strings.HasPrefix(lower, prefix) {
+				store = field[len(prefix):]
+				// Nama toko ada di kata berikutnya jika diketik "toko: gramedia"
+				if store == "" && i+1 < len(fields) {
+					i++
+					store = fields[i]
+				}
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			kept = append(kept, field)
+		}
+	}
+	return strings.Join(kept, " "), store
+}
+
+// filterByStore keeps the products that have a link at the store
+func filterByStore(products []*Product, store string) []*Product {
+	var filtered []*Product
+	for _, product := range products {
+		if _, found := product.Link(store); found {
+			filtered = append(filtered, product)
+		}
+	}
+	return filtered
+}
+
+// productLinks returns the store links of a product in the order they are shown, following the store view
+func productLinks(product *Product, view storeView) []StoreLink {
+	var links []StoreLink
+	for _, link := range product.Links {
+		if view.Only != "" && link.Store != view.Only {
+			continue
+		}
+		links = append(links, link)
+	}
+	priority := storePriority()
+	sort.SliceStable(links, func(a, b int) bool {
+		return storeRank(links[a].Store, priority, view.Preferred) < storeRank(links[b].Store, priority, view.Preferred)
+	})
+	return links
+}
+
+// storeButtonRows lays out the store buttons of a result in rows of storeButtonsPerRow
+func storeButtonRows(links []StoreLink) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, link := range links {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL(link.Store, link.URL))
+		if len(row) == storeButtonsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// userPreferredStore returns the store the user chose with /toko, else the default store of the chat set by a
+// group admin, empty if none was chosen
+func userPreferredStore(chatID, userID int64) string {
+	userDataMu.Lock()
+	db, err := datauser.LoadDatabase(userDataFile)
+	userDataMu.Unlock()
+	if err != nil {
+		log.Println("Gagal memuat data pengguna:", err)
+		return ""
+	}
+
+	if user, found := db.FindUser(userID); found && user.PreferredStore != "" {
+		return user.PreferredStore
+	}
+	if chat, found := db.FindChat(chatID); found {
+		return chat.PreferredStore
+	}
+	return ""
+}
+
+// setPreferredStore stores the preferred store of the user, an empty store clears it
+func setPreferredStore(chatID, userID int64, store string) {
+	updateUserRecord(userID, func(user *datauser.UserData) {
+		user.PreferredStore = store
+	})
+	if chatID == userID {
+		// Toko yang dulu disimpan di chat pribadi digantikan pilihan pengguna
+		updateChatRecord(chatID, func(chat *datauser.ChatData) {
+			chat.PreferredStore = ""
+		})
+	}
+}
+
+// setGroupStore stores the default store of a group, used for members who didn't choose their own
+func setGroupStore(chatID int64, store string) {
+	updateChatRecord(chatID, func(chat *datauser.ChatData) {
+		chat.PreferredStore = store
+	})
+}
+
+// storeKeyboard shows every store of the catalog as a button, plus one to clear the preference
+func storeKeyboard(products []Product, lang string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, store := range productStores(products) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(store, callbackStore+store))
+		if len(row) == storeButtonsPerRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "store_all"), callbackStore+storeAll)))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// storeChoiceText resolves a store chosen with /toko or its buttons, saves it with set and returns the
+// confirmation. setKey and clearedKey name the confirmations of a chosen and a cleared store.
+func storeChoiceText(products []Product, choice, lang string, set func(store string), setKey, clearedKey string) string {
+	if strings.EqualFold(strings.TrimSpace(choice), storeAll) {
+		set("")
+		return tr(lang, clearedKey)
+	}
+
+	store, found := findStore(products, choice)
+	if !found {
+		return tr(lang, "store_unknown", choice, strings.Join(productStores(products), ", "))
+	}
+	set(store)
+	return tr(lang, setKey, store, store)
+}
+
+// handleStore sets the preferred store of the user on /toko, or shows the stores to choose from.
+// In a group, "grup <nama>" sets the default store of the group instead, for group admins only.
+func handleStore(ctx *messageContext) {
+	if fields := strings.Fields(ctx.Args); ctx.Group != nil && len(fields) >= 2 && strings.EqualFold(fields[0], storeGroup) {
+		handleGroupStore(ctx, strings.Join(fields[1:], " "))
+		return
+	}
+	if ctx.Args == "" {
+		current := userPreferredStore(ctx.ChatID(), ctx.UserID())
+		if current == "" {
+			current = tr(ctx.Lang, "store_all")
+		}
+		text := tr(ctx.Lang, "store_choose", current)
+		if ctx.Group != nil {
+			text += "\n" + tr(ctx.Lang, "store_group_usage")
+		}
+		ctx.reply(text)
+		ctx.Msg.ReplyMarkup = storeKeyboard(ctx.Products, ctx.Lang)
+		return
+	}
+	ctx.reply(storeChoiceText(ctx.Products, ctx.Args, ctx.Lang, func(store string) {
+		setPreferredStore(ctx.ChatID(), ctx.UserID(), store)
+	}, "store_set", "store_cleared"))
+}
+
+// handleGroupStore sets the default store of a group on /toko grup <nama>. Only group admins may change it.
+func handleGroupStore(ctx *messageContext, choice string) {
+	if !isGroupAdmin(ctx.Bot.BotAPI, ctx.ChatID(), ctx.Update.Message.From.ID) {
+		ctx.reply(tr(ctx.Lang, "group_admin_only"))
+		return
+	}
+	ctx.reply(storeChoiceText(ctx.Products, choice, ctx.Lang, func(store string) {
+		setGroupStore(ctx.ChatID(), store)
+	}, "store_set_group", "store_cleared_group"))
+}
+
+// handleStoreCallback applies the store picked from the /toko keyboard to the user who pressed it
+func handleStoreCallback(query *tgbotapi.CallbackQuery, data string, products []Product, lang string, msg *tgbotapi.MessageConfig) {
+	if data == "" {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid store callback data")
+		return
+	}
+	msg.Text = storeChoiceText(products, data, lang, func(store string) {
+		setPreferredStore(query.Message.Chat.ID, query.From.ID, store)
+	}, "store_set", "store_cleared")
+}
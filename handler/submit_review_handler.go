@@ -0,0 +1,501 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+	datauser "github.com/1amkaizen/BookFinderBot/user"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// userReviewsFile is the JSON file holding reviews submitted through the bot
+const userReviewsFile = "user_reviews.json"
+
+// Moderation status of a submitted review
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// maxRating is the highest star rating a user can give
+const maxRating = 5
+
+// maxShownUserReviews is the number of approved reviews shown by the reader reviews button
+const maxShownUserReviews = 5
+
+// maxShownReviewLength cuts long reviews so the shown reviews fit in one Telegram message
+const maxShownReviewLength = 600
+
+// errReviewModerated is returned when moderating a review that is no longer pending
+var errReviewModerated = errors.New("review already moderated")
+
+// UserReview represents a review written by a user through the bot
+type UserReview struct {
+	ID          int64     `json:"id"`
+	ProductName string    `json:"product_name"`
+	UserID      int64     `json:"user_id"`
+	Username    string    `json:"username"`
+	Rating      int       `json:"rating"`
+	Text        string    `json:"text"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// productRating is the aggregated rating of a product from approved reviews
+type productRating struct {
+	Average float64
+	Count   int
+}
+
+// userReviewsMu serializes read-modify-write cycles on the user reviews file
+var userReviewsMu sync.Mutex
+
+// loadUserReviews loads the submitted reviews from a JSON file
+func loadUserReviews(filename string) ([]UserReview, error) {
+	var reviews []UserReview
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reviews, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &reviews)
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// saveUserReviews saves the submitted reviews to a JSON file
+func saveUserReviews(filename string, reviews []UserReview) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(reviews, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// productRatings aggregates the approved reviews per product name
+func productRatings(reviews []UserReview) map[string]productRating {
+	totals := make(map[string]int)
+	ratings := make(map[string]productRating)
+	for _, review := range reviews {
+		if review.Status != ReviewApproved {
+			continue
+		}
+		rating := ratings[review.ProductName]
+		rating.Count++
+		totals[review.ProductName] += review.Rating
+		rating.Average = float64(totals[review.ProductName]) / float64(rating.Count)
+		ratings[review.ProductName] = rating
+	}
+	return ratings
+}
+
+// loadProductRatings returns the current ratings of all products
+func loadProductRatings() map[string]productRating {
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	userReviewsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user reviews")
+	}
+	return productRatings(reviews)
+}
+
+// handleSubmitReview starts the /beriulasan flow, optionally with the book title as argument
+func handleSubmitReview(ctx *messageContext, title string) {
+	if title == "" {
+		startConversation(ctx.ChatID(), ctx.UserID(), flowSubmitReview, stepTitle)
+		ctx.reply(tr(ctx.Lang, "submit_ask_title"))
+		return
+	}
+	selectReviewProduct(ctx, title)
+}
+
+// continueSubmitReview continues the /beriulasan flow with the user's message
+func continueSubmitReview(ctx *messageContext, conversation *datauser.Conversation) {
+	update, lang := ctx.Update, ctx.Lang
+	switch conversation.Step {
+	case stepTitle:
+		selectReviewProduct(ctx, update.Message.Text)
+	case stepRating:
+		setConversation(ctx.ChatID(), ctx.UserID(), conversation)
+		askRating(conversation.Data["product"], lang, ctx.Msg)
+	case stepText:
+		// Foto, stiker, dan pesan lain tanpa teks tidak bisa dijadikan ulasan
+		if strings.TrimSpace(update.Message.Text) == "" {
+			setConversation(ctx.ChatID(), ctx.UserID(), conversation)
+			ctx.reply(tr(lang, "submit_text_required"))
+			return
+		}
+		rating, _ := strconv.Atoi(conversation.Data["rating"])
+		productName := conversation.Data["product"]
+		// Buku bisa saja diganti namanya oleh admin selama percakapan berlangsung
+		if product, found := ctx.Catalog.Lookup(productName); found {
+			productName = product.Nama
+		}
+		review := UserReview{
+			ProductName: productName,
+			UserID:      update.Message.From.ID,
+			Username:    update.Message.From.UserName,
+			Rating:      rating,
+			Text:        strings.TrimSpace(update.Message.Text),
+			Status:      ReviewPending,
+			CreatedAt:   time.Now(),
+		}
+		review, err := addUserReview(review)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to save user review")
+			ctx.reply(tr(lang, "submit_failed"))
+			return
+		}
+
+		clearConversation(ctx.ChatID(), ctx.UserID())
+		notifyAdminsOfReview(ctx.Bot, review)
+		ctx.reply(tr(lang, "submit_thanks"))
+	}
+}
+
+// selectReviewProduct looks up the book to review, asking the user to choose when several match
+func selectReviewProduct(ctx *messageContext, title string) {
+	products := ctx.Products
+	matches := bestMatches(searchNames(len(products), func(i int) string { return products[i].Nama }, title))
+	switch len(matches) {
+	case 0:
+		startConversation(ctx.ChatID(), ctx.UserID(), flowSubmitReview, stepTitle)
+		ctx.reply(tr(ctx.Lang, "submit_not_found", title) + "\n" + tr(ctx.Lang, "cancel_hint"))
+	case 1:
+		product := products[matches[0].Index]
+		askProductRating(ctx.ChatID(), ctx.UserID(), product.Nama, ctx.Lang, ctx.Msg)
+	default:
+		startConversation(ctx.ChatID(), ctx.UserID(), flowSubmitReview, stepTitle)
+		if len(matches) > maxReviewChoices {
+			matches = matches[:maxReviewChoices]
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, match := range matches {
+			button := tgbotapi.NewInlineKeyboardButtonData(products[match.Index].Nama, callbackRateBook+productKey(products[match.Index].Nama))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+		}
+		ctx.reply(tr(ctx.Lang, "submit_choose", title))
+		ctx.Msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+}
+
+// askProductRating moves the /beriulasan flow to the rating step for the chosen book
+func askProductRating(chatID, userID int64, productName string, lang string, msg *tgbotapi.MessageConfig) {
+	setConversation(chatID, userID, &datauser.Conversation{
+		Flow: flowSubmitReview,
+		Step: stepRating,
+		Data: map[string]string{"product": productName},
+	})
+	askRating(productName, lang, msg)
+}
+
+// askRating asks the user for a star rating with an inline keyboard
+func askRating(productName string, lang string, msg *tgbotapi.MessageConfig) {
+	var buttons []tgbotapi.InlineKeyboardButton
+	for rating := 1; rating <= maxRating; rating++ {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(rating)+"⭐", callbackRate+strconv.Itoa(rating)))
+	}
+	msg.Text = tr(lang, "submit_ask_rating", productName)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+}
+
+// handleRateBookCallback continues the /beriulasan flow with the book picked from the keyboard
+func handleRateBookCallback(chatID, userID int64, data string, products []Product, lang string, msg *tgbotapi.MessageConfig) {
+	conversation, found := getConversation(chatID, userID)
+	if !found || conversation.Flow != flowSubmitReview {
+		msg.Text = tr(lang, "conversation_expired")
+		return
+	}
+	product, found := findProductByKey(products, data)
+	if !found {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Unknown book in rate book callback data")
+		msg.Text = tr(lang, "product_missing")
+		return
+	}
+
+	askProductRating(chatID, userID, product.Nama, lang, msg)
+}
+
+// handleRateCallback stores the star rating picked from the keyboard and asks for the review text
+func handleRateCallback(chatID, userID int64, data string, lang string, msg *tgbotapi.MessageConfig) {
+	conversation, found := getConversation(chatID, userID)
+	if !found || conversation.Flow != flowSubmitReview || conversation.Step != stepRating {
+		msg.Text = tr(lang, "conversation_expired")
+		return
+	}
+	rating, err := strconv.Atoi(data)
+	if err != nil || rating < 1 || rating > maxRating {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid rating callback data")
+		return
+	}
+
+	conversation.Step = stepText
+	if conversation.Data == nil {
+		conversation.Data = make(map[string]string)
+	}
+	conversation.Data["rating"] = strconv.Itoa(rating)
+	setConversation(chatID, userID, conversation)
+	msg.Text = tr(lang, "submit_ask_text", rating)
+}
+
+// addUserReview stores a new review and returns it with its assigned ID
+func addUserReview(review UserReview) (UserReview, error) {
+	userReviewsMu.Lock()
+	defer userReviewsMu.Unlock()
+
+	reviews, err := loadUserReviews(userReviewsFile)
+	if err != nil {
+		return review, err
+	}
+
+	for _, existing := range reviews {
+		if existing.ID >= review.ID {
+			review.ID = existing.ID + 1
+		}
+	}
+	if review.ID == 0 {
+		review.ID = 1
+	}
+
+	reviews = append(reviews, review)
+	return review, saveUserReviews(userReviewsFile, reviews)
+}
+
+// setUserReviewStatus changes the moderation status of a review
+func setUserReviewStatus(id int64, status string) (UserReview, error) {
+	userReviewsMu.Lock()
+	defer userReviewsMu.Unlock()
+
+	reviews, err := loadUserReviews(userReviewsFile)
+	if err != nil {
+		return UserReview{}, err
+	}
+
+	for i := range reviews {
+		if reviews[i].ID == id {
+			if reviews[i].Status != ReviewPending {
+				return reviews[i], errReviewModerated
+			}
+			reviews[i].Status = status
+			return reviews[i], saveUserReviews(userReviewsFile, reviews)
+		}
+	}
+	return UserReview{}, os.ErrNotExist
+}
+
+// renameUserReviews moves the reviews of a book renamed in the catalog to its new title, so its ratings follow it
+func renameUserReviews(oldName, newName string) error {
+	userReviewsMu.Lock()
+	defer userReviewsMu.Unlock()
+
+	reviews, err := loadUserReviews(userReviewsFile)
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for i := range reviews {
+		if reviews[i].ProductName == oldName {
+			reviews[i].ProductName = newName
+			moved++
+		}
+	}
+	if moved == 0 {
+		return nil
+	}
+	return saveUserReviews(userReviewsFile, reviews)
+}
+
+// moderationMessage builds the message asking an admin to approve or reject a review
+func moderationMessage(chatID int64, review UserReview, lang string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, tr(lang, "moderation_review", review.ProductName, review.Username, review.UserID, review.Rating, review.Text))
+	id := strconv.FormatInt(review.ID, 10)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "moderation_approve"), callbackModerate+ReviewApproved+":"+id),
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "moderation_reject"), callbackModerate+ReviewRejected+":"+id),
+	))
+	return msg
+}
+
+// notifyAdminsOfReview asks every admin to moderate a newly submitted review
+func notifyAdminsOfReview(bot *sender, review UserReview) {
+	for _, adminID := range adminIDs() {
+		msg := moderationMessage(adminID, review, userLanguage(adminID, adminID, ""))
+		if _, err := bot.sendAbout(msg, review.UserID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":         err,
+				"admin_id_hash": hashID(adminID),
+			}).Error("Failed to notify admin of new review")
+		}
+	}
+}
+
+// handleModerationList sends the pending reviews to an admin, each with approve/reject buttons
+func handleModerationList(ctx *messageContext) {
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	userReviewsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user reviews")
+	}
+
+	pending := 0
+	for _, review := range reviews {
+		if review.Status != ReviewPending {
+			continue
+		}
+		pending++
+		if _, err := ctx.Bot.sendAbout(moderationMessage(ctx.ChatID(), review, ctx.Lang), review.UserID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to send moderation message")
+		}
+	}
+
+	ctx.reply(tr(ctx.Lang, "moderation_pending", pending))
+}
+
+// handleModerateCallback approves or rejects a review from the moderation buttons
+func handleModerateCallback(bot *sender, query *tgbotapi.CallbackQuery, data string, lang string, msg *tgbotapi.MessageConfig) {
+	if !isAdmin(query.From.ID) {
+		msg.Text = tr(lang, "admin_only")
+		return
+	}
+
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 || (parts[0] != ReviewApproved && parts[0] != ReviewRejected) {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid moderation callback data")
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Invalid moderation callback data")
+		return
+	}
+
+	review, err := setUserReviewStatus(id, parts[0])
+	if err == errReviewModerated {
+		// Admin lain sudah memoderasi ulasan ini, jangan beri tahu penulisnya dua kali
+		msg.Text = tr(lang, "moderation_already", review.ProductName, review.Username, review.Status)
+		sendModerationReply(bot, msg, review)
+		return
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":     err,
+			"review_id": id,
+		}).Error("Failed to moderate user review")
+		return
+	}
+
+	msg.Text = tr(lang, "moderation_done_"+review.Status, review.ProductName, review.Username)
+	sendModerationReply(bot, msg, review)
+
+	// Beri tahu penulis ulasan tentang hasil moderasi
+	authorLang := userLanguage(review.UserID, review.UserID, "")
+	notice := tgbotapi.NewMessage(review.UserID, tr(authorLang, "submit_"+review.Status, review.ProductName))
+	if _, err := bot.sendAbout(notice, review.UserID); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":        err,
+			"user_id_hash": hashID(review.UserID),
+		}).Error("Failed to notify review author")
+	}
+}
+
+// sendModerationReply sends the answer to a moderation button, which names the author of the review, tagged with
+// the author so it is erased with their data. msg is cleared so the callback handler doesn't send it again.
+func sendModerationReply(bot *sender, msg *tgbotapi.MessageConfig, review UserReview) {
+	if _, err := bot.sendAbout(*msg, review.UserID); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to send message")
+	}
+	msg.Text = ""
+}
+
+// approvedReviews returns the approved reviews of a product, newest first
+func approvedReviews(productName string) []UserReview {
+	userReviewsMu.Lock()
+	reviews, err := loadUserReviews(userReviewsFile)
+	userReviewsMu.Unlock()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Failed to load user reviews")
+	}
+
+	var approved []UserReview
+	for i := len(reviews) - 1; i >= 0; i-- {
+		if reviews[i].Status == ReviewApproved && reviews[i].ProductName == productName {
+			approved = append(approved, reviews[i])
+		}
+	}
+	return approved
+}
+
+// handleUserReviewsCallback shows the latest approved reviews of the book whose reader reviews button was pressed.
+// Reviewers are not named, as in the catalog API.
+func handleUserReviewsCallback(data string, products []Product, lang string, msg *tgbotapi.MessageConfig) {
+	product, found := findProductByKey(products, data)
+	if !found {
+		logrus.WithFields(logrus.Fields{
+			"data": data,
+		}).Warn("Unknown product in user reviews callback data")
+		msg.Text = tr(lang, "product_missing")
+		return
+	}
+
+	reviews := approvedReviews(product.Nama)
+	if len(reviews) == 0 {
+		msg.Text = tr(lang, "user_reviews_empty", product.Nama)
+		return
+	}
+	if len(reviews) > maxShownUserReviews {
+		reviews = reviews[:maxShownUserReviews]
+	}
+	lines := []string{tr(lang, "user_reviews", product.Nama)}
+	for _, review := range reviews {
+		text := []rune(review.Text)
+		if len(text) > maxShownReviewLength {
+			text = append(text[:maxShownReviewLength], '…')
+		}
+		lines = append(lines, strings.Repeat("⭐", review.Rating)+"\n"+string(text))
+	}
+	msg.Text = strings.Join(lines, "\n\n")
+}
+
+// formatRating renders the average rating of a product for search results
+func formatRating(rating productRating, lang string) string {
+	return tr(lang, "product_rating", fmt.Sprintf("%.1f", rating.Average), rating.Count)
+}
@@ -1,29 +1,68 @@
 package handler
 
 import (
-	"log"
+	"time"
 
+	"github.com/1amkaizen/BookFinderBot/metrics"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
 )
 
-func Webhook(app *fiber.App, bot *tgbotapi.BotAPI, products []Product, reviewLinks []ReviewLink) {
+func Webhook(app *fiber.App, bot *tgbotapi.BotAPI, catalog *Catalog, reviewLinks []ReviewLink) {
 	app.Post("/webhook", func(c *fiber.Ctx) error {
-		return handleWebhook(c, bot, products, reviewLinks)
+		return handleWebhook(c, bot, catalog, reviewLinks)
 	})
 }
 
-func handleWebhook(c *fiber.Ctx, bot *tgbotapi.BotAPI, products []Product, reviewLinks []ReviewLink) error {
+func handleWebhook(c *fiber.Ctx, bot *tgbotapi.BotAPI, catalog *Catalog, reviewLinks []ReviewLink) error {
+	start := time.Now()
+	requestID := c.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	c.Set(requestIDHeader, requestID)
+
 	update := new(tgbotapi.Update)
 	if err := c.BodyParser(update); err != nil {
-		log.Println("Gagal memparsing update:", err)
+		logrus.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"error":      err,
+		}).Error("Failed to parse update")
 		return err
 	}
 
-	if update.Message == nil {
-		return nil
+	entry := logrus.WithFields(logrus.Fields{
+		"request_id": requestID,
+		"update_id":  update.UpdateID,
+	})
+
+	updateType := "other"
+	switch {
+	case update.CallbackQuery != nil:
+		updateType = "callback_query"
+		metrics.UpdatesReceived.Inc(updateType)
+		handleCallback(update, bot, catalog, reviewLinks, entry)
+	case update.Message != nil:
+		updateType = "message"
+		metrics.UpdatesReceived.Inc(updateType)
+		handleMessage(update, bot, catalog, reviewLinks, entry)
+	default:
+		metrics.UpdatesReceived.Inc(updateType)
 	}
 
-	handleMessage(update, bot, products, reviewLinks)
+	entry.WithFields(logrus.Fields{
+		"update_type": updateType,
+		"latency_ms":  time.Since(start).Milliseconds(),
+	}).Info("Update handled")
 	return nil
 }
+
+// Metrics registers the /metrics route serving the bot metrics in the Prometheus text format
+func Metrics(app *fiber.App) {
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, metrics.ContentType)
+		metrics.Write(c)
+		return nil
+	})
+}
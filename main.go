@@ -3,22 +3,47 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/1amkaizen/BookFinderBot/handler"
+	"github.com/1amkaizen/BookFinderBot/metrics"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
 )
 
+// telegramTimeout bounds every call to the Telegram Bot API
+const telegramTimeout = 30 * time.Second
+
 func main() {
-	// Setup logrus
-	logrus.SetFormatter(&logrus.TextFormatter{
-		ForceColors:   true,
-		FullTimestamp: true,
-	})
-	logrus.SetLevel(logrus.DebugLevel)
+	// Setup logrus: JSON secara bawaan, LOG_FORMAT=text untuk log yang mudah dibaca saat pengembangan.
+	// TextFormatter hanya memakai warna ANSI jika output adalah terminal.
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	} else {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
+	level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+	logrus.AddHook(handler.SecretRedactionHook{})
+
+	// Arahkan paket log standar ke logrus agar semua log terstruktur dan tersensor
+	log.SetFlags(0)
+	log.SetOutput(logrus.StandardLogger().Writer())
+
+	// Hash ID di log dan daftar opt-out broadcast butuh salt yang tetap sejak awal
+	if err := handler.InitHashSalt(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Failed to set up the hash salt")
+	}
 
 	// Mendapatkan token bot dari secrets atau variabel lingkungan di Koyeb
 	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
@@ -27,7 +52,9 @@ func main() {
 	}
 
 	// Inisialisasi bot Telegram
-	bot, err := tgbotapi.NewBotAPI(botToken)
+	// Klien HTTP yang mencatat latensi dan error setiap panggilan Telegram Bot API
+	client := &metrics.InstrumentedClient{Client: &http.Client{Timeout: telegramTimeout}}
+	bot, err := tgbotapi.NewBotAPIWithClient(botToken, tgbotapi.APIEndpoint, client)
 	if err != nil {
 		logrus.Panic(err)
 	}
@@ -40,6 +67,14 @@ func main() {
 		}).Fatal("Failed to load data")
 	}
 
+	// Terapkan perubahan katalog dari perintah admin di atas products.txt
+	catalog, err := handler.OpenCatalog(products, reviewLinks)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Failed to load catalog changes")
+	}
+
 	// Mendapatkan URL webhook dari secrets atau variabel lingkungan di Koyeb
 	webhookURL := os.Getenv("WEBHOOK_URL")
 	if webhookURL == "" {
@@ -77,18 +112,47 @@ func main() {
 
 	logrus.Info("Webhook successfully set")
 
-	bot.Debug = true
+	// Daftarkan perintah bot agar muncul di menu Telegram
+	handler.RegisterCommands(bot)
+
+	// Hapus pesan lama dari data pengguna secara berkala sesuai kebijakan retensi
+	handler.StartRetention()
+
+	// Jalankan antrean broadcast, termasuk broadcast yang terhenti saat restart
+	handler.StartBroadcasts(bot)
 
 	// Inisialisasi GoFiber
 	app := fiber.New()
 
-	// Panggil fungsi webhook dengan menyediakan app, bot, products, dan reviewLinks
-	handler.Webhook(app, bot, products, reviewLinks)
+	// Panggil fungsi webhook dengan menyediakan app, bot, katalog, dan reviewLinks
+	handler.Webhook(app, bot, catalog, reviewLinks)
+
+	// Endpoint pengalihan link toko untuk mencatat klik
+	handler.Redirect(app, catalog)
+
+	// API katalog publik untuk website dan bot lain
+	handler.API(app, catalog)
+
+	// API admin untuk data pengguna dan percakapan
+	handler.AdminAPI(app, bot)
+
+	// Endpoint laporan analitik pencarian untuk admin
+	handler.Analytics(app)
+
+	// Endpoint broadcast untuk form di dashboard admin
+	handler.Broadcasts(app)
+
+	// Endpoint metrik Prometheus
+	handler.Metrics(app)
+
+	// Endpoint health check dan readiness untuk platform deploy
+	handler.Health(app, bot, catalog)
+
+	// Login dashboard admin dengan cookie sesi
+	handler.AdminLogin(app)
 
-	// Endpoint untuk melayani file HTML
-	app.Get("/html", func(c *fiber.Ctx) error {
-		return c.SendFile("user_data.html")
-	})
+	// Dashboard admin dengan feed pesan langsung (SSE) dan halaman HTML data pengguna
+	handler.Dashboard(app)
 
 	// Tentukan alamat dan port
 	addr := ":3000"
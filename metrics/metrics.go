@@ -0,0 +1,258 @@
+// Package metrics keeps the bot counters and histograms and renders them in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the default latency buckets in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics of the bot
+var (
+	UpdatesReceived         = NewCounterVec("bookfinder_updates_received_total", "Telegram updates received, by update type.", "type")
+	CommandsHandled         = NewCounterVec("bookfinder_commands_handled_total", "Bot commands handled, by command.", "command")
+	SearchDuration          = NewHistogramVec("bookfinder_search_duration_seconds", "Time spent searching the catalog.", DefBuckets)
+	SearchResults           = NewHistogramVec("bookfinder_search_results", "Number of products found per search.", []float64{0, 1, 2, 5, 10, 20, 50, 100})
+	TelegramRequestDuration = NewHistogramVec("bookfinder_telegram_request_duration_seconds", "Latency of Telegram Bot API calls, by method.", DefBuckets, "method")
+	TelegramRequestErrors   = NewCounterVec("bookfinder_telegram_request_errors_total", "Failed Telegram Bot API calls, by method.", "method")
+	StorageWriteDuration    = NewHistogramVec("bookfinder_storage_write_duration_seconds", "Time spent writing data files, by file.", DefBuckets, "file")
+)
+
+// metric is a metric family that can render itself
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	series map[string][]string
+}
+
+// NewCounterVec creates and registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		values:     make(map[string]float64),
+		series:     make(map[string][]string),
+	}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the counter of the label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += delta
+	c.series[key] = labelValues
+}
+
+func (c *CounterVec) name() string {
+	return c.metricName
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labelPairs(c.labels, c.series[key], "", ""), formatValue(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		values:     make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe records a value in the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, found := h.values[key]
+	if !found {
+		series = &histogram{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) name() string {
+	return h.metricName
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelPairs(h.labels, series.labelValues, "le", formatValue(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labelPairs(h.labels, series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labelPairs(h.labels, series.labelValues, "", ""), formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labelPairs(h.labels, series.labelValues, "", ""), series.count)
+	}
+}
+
+// Write renders every registered metric in the Prometheus text exposition format
+func Write(w io.Writer) {
+	registryMu.Lock()
+	metrics := make([]metric, len(registry))
+	copy(metrics, registry)
+	registryMu.Unlock()
+
+	sort.Slice(metrics, func(a, b int) bool {
+		return metrics[a].name() < metrics[b].name()
+	})
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// InstrumentedClient is an HTTP client for the Telegram Bot API that records the latency and errors of each method
+type InstrumentedClient struct {
+	Client *http.Client
+}
+
+// Do sends the request and records its latency under the API method, the last part of the URL path.
+// The path also holds the bot token, which is never used as a label.
+func (c *InstrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+	TelegramRequestDuration.ObserveSince(start, method)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		TelegramRequestErrors.Inc(method)
+	}
+	return resp, err
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelPairs renders {name="value",...}, with an extra pair such as le for histogram buckets
+func labelPairs(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, name+`="`+escapeLabel(value)+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
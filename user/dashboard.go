@@ -0,0 +1,410 @@
+package datauser
+
+// DashboardPage is the live admin dashboard served at /dashboard. Unlike user_data.html it holds no data:
+// the counters and the message feed come from the /dashboard/events stream, and the conversations are loaded
+// on demand from the admin API. Like the other cards, it authenticates with the session cookie set by /login.
+const DashboardPage = dashboardHeader + liveCards + searchAnalyticsCard + broadcastCard + dashboardFooter
+
+// LoginPage is the form served at /login, which exchanges ADMIN_TOKEN for the session cookie of the dashboards
+const LoginPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>BookFinderBot | Log in</title>
+<link rel="stylesheet" href="https://fonts.googleapis.com/css?family=Source+Sans+Pro:300,400,400i,700&display=fallback">
+<link rel="stylesheet" href="https://adminlte.io/themes/v3/dist/css/adminlte.min.css?v=3.2.0">
+</head>
+<body class="dark-mode hold-transition login-page">
+<div class="login-box">
+<div class="login-logo"><b>BookFinderBot</b> Admin</div>
+<div class="card">
+<div class="card-body login-card-body">
+<p class="login-box-msg">Enter the ADMIN_TOKEN to open the dashboards</p>
+<p class="text-danger" id="login-error" style="display: none">Invalid admin token</p>
+<form method="post" id="login-form">
+<div class="input-group mb-3">
+<input type="password" name="token" class="form-control" placeholder="Admin token" autocomplete="current-password" required autofocus>
+</div>
+<button type="submit" class="btn btn-primary btn-block">Log in</button>
+</form>
+</div>
+</div>
+</div>
+<script>
+(function () {
+  var params = new URLSearchParams(window.location.search);
+  // Token dikirim di body form, tujuan setelah login tetap di parameter next
+  document.getElementById("login-form").action = "/login?" + new URLSearchParams({ next: params.get("next") || "/dashboard" }).toString();
+  if (params.get("error")) { document.getElementById("login-error").style.display = ""; }
+})();
+</script>
+</body>
+</html>`
+
+// dashboardHeader opens the live dashboard page, up to the content row
+const dashboardHeader = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>BookFinderBot | Dashboard</title>
+<link rel="stylesheet" href="https://fonts.googleapis.com/css?family=Source+Sans+Pro:300,400,400i,700&display=fallback">
+<link rel="stylesheet" href="https://adminlte.io/themes/v3/plugins/fontawesome-free/css/all.min.css">
+<link rel="stylesheet" href="https://adminlte.io/themes/v3/dist/css/adminlte.min.css?v=3.2.0">
+<style>
+#live-feed { max-height: 480px; overflow-y: auto; }
+#conversation-users { max-height: 160px; overflow-y: auto; }
+#conversation-messages { height: 400px; }
+</style>
+</head>
+<body class="dark-mode hold-transition sidebar-mini">
+<div class="wrapper">
+<nav class="main-header navbar navbar-expand navbar-white navbar-light">
+<ul class="navbar-nav">
+<li class="nav-item">
+<a class="nav-link" data-widget="pushmenu" href="#" role="button"><i class="fas fa-bars"></i></a>
+</li>
+</ul>
+<ul class="navbar-nav ml-auto">
+<li class="nav-item">
+<span class="nav-link"><span id="live-status" class="badge badge-secondary">Connecting...</span></span>
+</li>
+<li class="nav-item">
+<form method="post" action="/logout"><button type="submit" class="btn btn-link nav-link">Log out</button></form>
+</li>
+</ul>
+</nav>
+<aside class="main-sidebar sidebar-dark-primary elevation-4">
+<a href="#" class="brand-link">
+<img src="https://media.giphy.com/media/mAgG12Pk85e1mc31HJ/giphy.gif" alt="BookFinderBot Logo" class="brand-image img-circle elevation-3" style="opacity: .8">
+<span class="brand-text font-weight-light">BookFinderBot</span>
+</a>
+<div class="sidebar">
+<nav class="mt-2">
+<ul class="nav nav-pills nav-sidebar flex-column" role="menu">
+<li class="nav-item">
+<a href="#live" class="nav-link">
+<i class="nav-icon fas fa-tachometer-alt"></i>
+<p>Live</p>
+</a>
+</li>
+<li class="nav-item">
+<a href="#conversations" class="nav-link">
+<i class="nav-icon fas fa-comments"></i>
+<p>Conversations</p>
+</a>
+</li>
+<li class="nav-item">
+<a href="#search-analytics" class="nav-link">
+<i class="nav-icon fas fa-chart-bar"></i>
+<p>Search Analytics</p>
+</a>
+</li>
+<li class="nav-item">
+<a href="#broadcasts" class="nav-link">
+<i class="nav-icon fas fa-bullhorn"></i>
+<p>Broadcast</p>
+</a>
+</li>
+</ul>
+</nav>
+</div>
+</aside>
+<div class="content-wrapper">
+<section class="content-header">
+<div class="container-fluid">
+<h1>Dashboard</h1>
+</div>
+</section>
+<section class="content">
+<div class="container-fluid">
+<div class="row">`
+
+// liveCards are the live counters, the message feed and the conversation viewer
+const liveCards = `
+<div class="col-lg-3 col-6" id="live">
+<div class="small-box bg-info">
+<div class="inner"><h3 id="stat-messages">-</h3><p>Messages today</p></div>
+<div class="icon"><i class="fas fa-envelope"></i></div>
+<span class="small-box-footer" id="stat-replies">&nbsp;</span>
+</div>
+</div>
+<div class="col-lg-3 col-6">
+<div class="small-box bg-success">
+<div class="inner"><h3 id="stat-active">-</h3><p>Active users today</p></div>
+<div class="icon"><i class="fas fa-user-check"></i></div>
+<span class="small-box-footer" id="stat-users">&nbsp;</span>
+</div>
+</div>
+<div class="col-lg-3 col-6">
+<div class="small-box bg-warning">
+<div class="inner"><h3 id="stat-zero">-</h3><p>Zero-result searches today</p></div>
+<div class="icon"><i class="fas fa-search-minus"></i></div>
+<span class="small-box-footer" id="stat-searches">&nbsp;</span>
+</div>
+</div>
+<div class="col-lg-3 col-6">
+<div class="small-box bg-secondary">
+<div class="inner"><h3 id="stat-chats">-</h3><p>Chats</p></div>
+<div class="icon"><i class="fas fa-comments"></i></div>
+<span class="small-box-footer" id="stat-updated">&nbsp;</span>
+</div>
+</div>
+<div class="col-md-6">
+<div class="card">
+<div class="card-header">
+<h3 class="card-title">Live Feed</h3>
+<div class="card-tools">
+<button type="button" id="live-pause" class="btn btn-tool">Pause</button>
+</div>
+</div>
+<div class="card-body p-0">
+<ul id="live-feed" class="list-group list-group-flush"></ul>
+</div>
+</div>
+</div>
+<div class="col-md-6" id="conversations">
+<div class="card direct-chat direct-chat-primary">
+<div class="card-header">
+<h3 class="card-title" id="conversation-title">Conversations</h3>
+</div>
+<div class="card-body p-2">
+<input type="search" id="conversation-search" class="form-control form-control-sm mb-2" placeholder="Search users by name, username or ID">
+<ul id="conversation-users" class="list-group list-group-flush mb-2"></ul>
+<div id="conversation-messages" class="direct-chat-messages"></div>
+<button type="button" id="conversation-older" class="btn btn-sm btn-secondary btn-block" style="display: none">Load older messages</button>
+</div>
+<div class="card-footer" id="conversation-reply" style="display: none">
+<div class="custom-control custom-switch mb-2">
+<input type="checkbox" class="custom-control-input" id="conversation-handoff">
+<label class="custom-control-label" for="conversation-handoff">Pause bot replies while I handle this user</label>
+<small class="text-muted ml-2" id="conversation-handoff-status"></small>
+</div>
+<form id="conversation-form">
+<div class="input-group">
+<input type="text" id="conversation-text" class="form-control" maxlength="4096" placeholder="Reply as admin through the bot">
+<span class="input-group-append"><button type="submit" class="btn btn-primary">Send</button></span>
+</div>
+</form>
+<small class="text-danger" id="conversation-error"></small>
+</div>
+</div>
+</div>
+<script>
+(function () {
+  var maxFeedItems = 100;
+  var paused = false;
+  var conversation = { userID: null, page: 1, totalPages: 0 };
+
+  function request(path, method, body) {
+    var options = { method: method || "GET", headers: {} };
+    if (body !== undefined) {
+      options.headers["Content-Type"] = "application/json";
+      options.body = JSON.stringify(body);
+    }
+    return fetch(path, options).then(function (response) {
+      return response.json().then(function (data) {
+        if (!response.ok) { throw new Error(data.error); }
+        return data;
+      });
+    });
+  }
+  function text(id, value) { document.getElementById(id).textContent = value; }
+  function time(value) { return new Date(value).toLocaleString(); }
+  function element(tag, className, content) {
+    var node = document.createElement(tag);
+    if (className) { node.className = className; }
+    if (content !== undefined) { node.textContent = content; }
+    return node;
+  }
+
+  function showStats(stats) {
+    text("stat-messages", stats.messages_today);
+    text("stat-replies", stats.replies_today + " bot replies, " + stats.admin_messages_today + " admin messages");
+    text("stat-active", stats.active_users);
+    text("stat-users", stats.users + " users in total");
+    text("stat-zero", stats.zero_result_searches);
+    text("stat-searches", "of " + stats.searches + " searches");
+    text("stat-chats", stats.chats);
+    text("stat-updated", "Updated " + new Date(stats.updated_at).toLocaleTimeString());
+  }
+
+  // senderName names the bot and the admins, who have no user of their own
+  function senderName(message, name) {
+    if (message.sender === "bot") { return "BookFinderBot"; }
+    if (message.sender === "admin") { return "Admin"; }
+    return name;
+  }
+
+  // messageNode renders a message as a direct chat bubble, bot and admin messages on the right
+  function messageNode(message, name) {
+    var bot = message.sender === "bot" || message.sender === "admin";
+    var node = element("div", bot ? "direct-chat-msg right" : "direct-chat-msg");
+    var infos = element("div", "direct-chat-infos clearfix");
+    infos.appendChild(element("span", "direct-chat-name " + (bot ? "float-right" : "float-left"), senderName(message, name || String(message.user_id || ""))));
+    infos.appendChild(element("span", "direct-chat-timestamp " + (bot ? "float-left" : "float-right"), time(message.timestamp)));
+    node.appendChild(infos);
+    var body = element("div", "direct-chat-text", message.content);
+    (message.buttons || []).forEach(function (button) {
+      body.appendChild(document.createTextNode(" "));
+      body.appendChild(element("span", "badge badge-light", button.text));
+    });
+    node.appendChild(body);
+    return node;
+  }
+
+  function showFeedMessage(message) {
+    if (paused) { return; }
+    var feed = document.getElementById("live-feed");
+    var item = element("li", "list-group-item");
+    var where = message.chat_title ? message.chat_title : (message.chat_type === "private" ? "private" : String(message.chat_id));
+    var who = senderName(message, message.name || String(message.user_id || message.chat_id));
+    var header = element("div", "d-flex justify-content-between");
+    // Balasan bot di grup tidak punya pengguna, hanya pesan pengguna dan chat pribadi yang bisa dibuka
+    var userID = message.user_id || (message.chat_id > 0 ? message.chat_id : 0);
+    var link = element(userID ? "a" : "span", message.sender === "bot" ? "text-info" : (message.sender === "admin" ? "text-success" : "text-warning"), who + " · " + where);
+    if (userID) {
+      link.href = "#conversations";
+      link.addEventListener("click", function () { openConversation(userID, message.name); });
+    }
+    header.appendChild(link);
+    header.appendChild(element("small", "text-muted", time(message.timestamp)));
+    item.appendChild(header);
+    item.appendChild(element("div", "text-break", message.content));
+    feed.insertBefore(item, feed.firstChild);
+    while (feed.children.length > maxFeedItems) { feed.removeChild(feed.lastChild); }
+  }
+
+  function connect() {
+    var source = new EventSource("/dashboard/events");
+    source.addEventListener("open", function () {
+      var status = document.getElementById("live-status");
+      status.className = "badge badge-success";
+      status.textContent = "Live";
+    });
+    source.addEventListener("error", function () {
+      var status = document.getElementById("live-status");
+      status.className = "badge badge-danger";
+      status.textContent = "Reconnecting...";
+    });
+    source.addEventListener("stats", function (event) { showStats(JSON.parse(event.data)); });
+    source.addEventListener("message", function (event) {
+      var message = JSON.parse(event.data);
+      showFeedMessage(message);
+      showConversationMessage(message);
+    });
+  }
+
+  function searchUsers() {
+    var query = new URLSearchParams({ q: document.getElementById("conversation-search").value, per_page: "20" });
+    request("/api/admin/users?" + query.toString()).then(function (list) {
+      var users = document.getElementById("conversation-users");
+      users.innerHTML = "";
+      list.users.forEach(function (user) {
+        var name = user.username || (user.first_name + " " + user.last_name).trim() || String(user.id);
+        var item = element("a", "list-group-item list-group-item-action py-1", name + " (" + user.message_count + " messages)");
+        item.href = "#conversations";
+        item.addEventListener("click", function () { openConversation(user.id, name); });
+        users.appendChild(item);
+      });
+    }).catch(function (error) {
+      text("conversation-title", "Users unavailable: " + error.message);
+    });
+  }
+
+  // showConversationMessage adds a live message to the open conversation, including the replies sent from here
+  function showConversationMessage(message) {
+    if (!conversation.userID || (message.chat_id !== conversation.userID && message.user_id !== conversation.userID)) { return; }
+    var messages = document.getElementById("conversation-messages");
+    messages.appendChild(messageNode(message, conversation.name));
+    messages.scrollTop = messages.scrollHeight;
+  }
+
+  function showHandoff(handoff) {
+    document.getElementById("conversation-handoff").checked = handoff.paused;
+    text("conversation-handoff-status", handoff.paused && handoff.expires_at ? "until " + time(handoff.expires_at) : "");
+  }
+
+  function loadConversation() {
+    var query = new URLSearchParams({ page: String(conversation.page), per_page: "50" });
+    return request("/api/admin/users/" + conversation.userID + "/messages?" + query.toString()).then(function (list) {
+      var messages = document.getElementById("conversation-messages");
+      // Pesan diurutkan dari yang terbaru, halaman berikutnya berisi pesan yang lebih lama
+      list.messages.forEach(function (message) {
+        messages.insertBefore(messageNode(message, conversation.name), messages.firstChild);
+      });
+      conversation.totalPages = list.pagination.total_pages;
+      if (conversation.page === 1) { showHandoff(list.handoff); }
+      document.getElementById("conversation-older").style.display = conversation.page < conversation.totalPages ? "" : "none";
+      return list;
+    });
+  }
+
+  function openConversation(userID, name) {
+    conversation = { userID: userID, name: name, page: 1, totalPages: 0 };
+    text("conversation-title", "Conversation with " + (name || userID));
+    document.getElementById("conversation-messages").innerHTML = "";
+    document.getElementById("conversation-reply").style.display = "";
+    text("conversation-error", "");
+    loadConversation().then(function () {
+      var messages = document.getElementById("conversation-messages");
+      messages.scrollTop = messages.scrollHeight;
+    }).catch(function (error) {
+      text("conversation-title", "Conversation unavailable: " + error.message);
+    });
+  }
+
+  document.getElementById("live-pause").addEventListener("click", function () {
+    paused = !paused;
+    this.textContent = paused ? "Resume" : "Pause";
+  });
+  document.getElementById("conversation-search").addEventListener("input", searchUsers);
+  document.getElementById("conversation-older").addEventListener("click", function () {
+    conversation.page++;
+    loadConversation();
+  });
+  document.getElementById("conversation-form").addEventListener("submit", function (event) {
+    event.preventDefault();
+    var input = document.getElementById("conversation-text");
+    if (!conversation.userID || !input.value.trim()) { return; }
+    // Pesan terkirim muncul di percakapan lewat event stream, seperti pesan lainnya
+    request("/api/admin/users/" + conversation.userID + "/messages", "POST", { text: input.value }).then(function (result) {
+      input.value = "";
+      text("conversation-error", "");
+      showHandoff(result.handoff);
+    }).catch(function (error) {
+      text("conversation-error", "Not sent: " + error.message);
+    });
+  });
+  document.getElementById("conversation-handoff").addEventListener("change", function () {
+    var checkbox = this;
+    request("/api/admin/users/" + conversation.userID + "/handoff", "PUT", { paused: checkbox.checked }).then(function (handoff) {
+      text("conversation-error", "");
+      showHandoff(handoff);
+    }).catch(function (error) {
+      checkbox.checked = !checkbox.checked;
+      text("conversation-error", "Handoff not changed: " + error.message);
+    });
+  });
+
+  connect();
+  searchUsers();
+})();
+</script>`
+
+// dashboardFooter closes the live dashboard page
+const dashboardFooter = `
+</div>
+</div>
+</section>
+</div>
+<footer class="main-footer">
+<strong>BookFinderBot</strong> live dashboard
+</footer>
+</div>
+<script src="https://adminlte.io/themes/v3/plugins/jquery/jquery.min.js"></script>
+<script src="https://adminlte.io/themes/v3/plugins/bootstrap/js/bootstrap.bundle.min.js"></script>
+<script src="https://adminlte.io/themes/v3/dist/js/adminlte.min.js?v=3.2.0"></script>
+</body>
+</html>`
@@ -2,37 +2,172 @@ package datauser
 
 import (
 	"encoding/json"
+	"html"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/1amkaizen/BookFinderBot/metrics"
+)
+
+// Chat types, as reported by Telegram
+const (
+	ChatPrivate    = "private"
+	ChatGroup      = "group"
+	ChatSupergroup = "supergroup"
+	ChatChannel    = "channel"
 )
 
-// UserData represents data of a user
+// Database holds the users, the chats the bot talks in and which users were seen in which chat.
+// A private chat has the same ID as its user, group chats have negative IDs.
+type Database struct {
+	Users       []UserData   `json:"users"`
+	Chats       []ChatData   `json:"chats"`
+	Memberships []Membership `json:"memberships"`
+}
+
+// UserData represents data of a user. The profile photo is kept as its Telegram file ID: a direct file URL
+// contains the bot token, so the photo is only served through the admin API.
 type UserData struct {
-	ID              int64     `json:"id"`
-	ProfilePhotoURL string    `json:"profile_photo_url"`
-	Username        string    `json:"username"`
-	FirstName       string    `json:"first_name"`
-	LastName        string    `json:"last_name"`
-	PhoneNumber     string    `json:"phone_number"`
-	Messages        []Message `json:"messages"`
+	ID                 int64  `json:"id"`
+	ProfilePhotoFileID string `json:"profile_photo_file_id,omitempty"`
+	Username           string `json:"username"`
+	FirstName          string `json:"first_name"`
+	LastName           string `json:"last_name"`
+	PhoneNumber        string `json:"phone_number"`
+	LanguageCode       string `json:"language_code,omitempty"`
+	// Language is the language chosen with /bahasa, which overrides LanguageCode and the group default
+	Language string `json:"language,omitempty"`
+	// PreferredStore is the store chosen with /toko, which overrides the group default
+	PreferredStore string `json:"preferred_store,omitempty"`
+	// Unsubscribed is set by /berhenti: the user receives no more broadcasts
+	Unsubscribed bool `json:"unsubscribed,omitempty"`
+}
+
+// ChatData represents a chat with the bot: its settings, conversation state and message history.
+// Language and PreferredStore are the defaults of a group set by a group admin; the choices of a user are kept on UserData.
+type ChatData struct {
+	ID             int64         `json:"id"`
+	Type           string        `json:"type"`
+	Title          string        `json:"title,omitempty"`
+	Language       string        `json:"language,omitempty"`
+	PreferredStore string        `json:"preferred_store,omitempty"`
+	Conversation   *Conversation `json:"conversation,omitempty"`
+	// MemberConversations holds the conversation of each group member by user ID, so members of a group
+	// can run multi-step commands at the same time
+	MemberConversations map[int64]*Conversation `json:"member_conversations,omitempty"`
+	Handoff             *Handoff                `json:"handoff,omitempty"`
+	Archived            MessageStats            `json:"archived"`
+	Messages            []Message               `json:"messages"`
+}
+
+// Membership records that a user sent messages in a chat
+type Membership struct {
+	ChatID       int64     `json:"chat_id"`
+	UserID       int64     `json:"user_id"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	MessageCount int       `json:"message_count"`
+}
+
+// ConversationOf returns the conversation a user is in: the one of the chat itself in a private chat,
+// the one of the member in a group
+func (c *ChatData) ConversationOf(userID int64) *Conversation {
+	if userID == c.ID {
+		return c.Conversation
+	}
+	return c.MemberConversations[userID]
+}
+
+// SetConversationOf stores the conversation of a user in the chat, nil ends it
+func (c *ChatData) SetConversationOf(userID int64, conversation *Conversation) {
+	if userID == c.ID {
+		c.Conversation = conversation
+		return
+	}
+	if conversation == nil {
+		delete(c.MemberConversations, userID)
+		return
+	}
+	if c.MemberConversations == nil {
+		c.MemberConversations = make(map[int64]*Conversation)
+	}
+	c.MemberConversations[userID] = conversation
+}
+
+// Conversation is the state of a multi-step command a user is in the middle of
+type Conversation struct {
+	Flow      string            `json:"flow"`
+	Step      string            `json:"step"`
+	Data      map[string]string `json:"data,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Handoff is set while an admin handles a private chat from the dashboard: the bot stores the user messages
+// without answering them. UpdatedAt is the time of the last admin action, from which the handoff expires.
+type Handoff struct {
+	Since     time.Time `json:"since"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HandedOff reports whether the bot replies of the chat are paused at now. A handoff without admin action
+// for longer than timeout is over; a zero timeout never ends it.
+func (c *ChatData) HandedOff(now time.Time, timeout time.Duration) bool {
+	if c.Handoff == nil {
+		return false
+	}
+	return timeout == 0 || now.Sub(c.Handoff.UpdatedAt) < timeout
 }
 
-// Message represents a single message in the conversation
+// Message represents a single message in the conversation. Sender is "user", "bot", or "admin" for a message
+// an admin sent from the dashboard. UserID is the author of a user message.
+// Bot messages also keep their Telegram message ID, the products they show, their buttons and AboutUserID,
+// the user they answer or name, e.g. the author of a review sent to the admins.
 type Message struct {
-	Content   string    `json:"content"`
-	Sender    string    `json:"sender"`
-	Timestamp time.Time `json:"timestamp"`
+	Content     string    `json:"content"`
+	Sender      string    `json:"sender"`
+	UserID      int64     `json:"user_id,omitempty"`
+	MessageID   int       `json:"message_id,omitempty"`
+	Kind        string    `json:"kind,omitempty"`
+	Products    []string  `json:"products,omitempty"`
+	Buttons     []Button  `json:"buttons,omitempty"`
+	AboutUserID int64     `json:"about_user_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
 }
 
-// LoadUserData loads user data from a JSON file
-func LoadUserData(filename string) ([]UserData, error) {
-	var users []UserData
+// Kinds of bot messages other than plain text
+const (
+	KindDocument = "document"
+	KindEdit     = "edit"
+)
+
+// Button is an inline keyboard button of a bot message
+type Button struct {
+	Text string `json:"text"`
+	URL  string `json:"url,omitempty"`
+	Data string `json:"data,omitempty"`
+}
+
+// legacyUserData is a record of the old user data file, which was a list of records keyed by chat ID
+// mixing the user profile with the chat settings and messages
+type legacyUserData struct {
+	UserData
+	Language       string        `json:"language,omitempty"`
+	PreferredStore string        `json:"preferred_store,omitempty"`
+	Conversation   *Conversation `json:"conversation,omitempty"`
+	Archived       MessageStats  `json:"archived"`
+	Messages       []Message     `json:"messages"`
+}
+
+// LoadDatabase loads the user data from a JSON file, converting files in the old format
+func LoadDatabase(filename string) (*Database, error) {
+	db := &Database{}
 	file, err := os.Open(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return users, nil // Return empty slice if file does not exist
+			return db, nil // Return an empty database if file does not exist
 		}
 		return nil, err
 	}
@@ -43,17 +178,58 @@ func LoadUserData(filename string) ([]UserData, error) {
 		return nil, err
 	}
 
-	err = json.Unmarshal(data, &users)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		var legacy []legacyUserData
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, err
+		}
+		return migrateLegacy(legacy), nil
+	}
+
+	err = json.Unmarshal(data, db)
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return db, nil
+}
+
+// migrateLegacy splits old records into users, chats and memberships. Old records of group chats
+// carry the profile of whoever wrote first, which can't be attributed reliably, so only private
+// chats yield a user record.
+func migrateLegacy(legacy []legacyUserData) *Database {
+	db := &Database{}
+	for _, record := range legacy {
+		chat := ChatData{
+			ID:             record.ID,
+			Type:           ChatGroup,
+			Language:       record.Language,
+			PreferredStore: record.PreferredStore,
+			Conversation:   record.Conversation,
+			Archived:       record.Archived,
+			Messages:       record.Messages,
+		}
+		if record.ID > 0 {
+			chat.Type = ChatPrivate
+			db.Users = append(db.Users, record.UserData)
+			membership := Membership{ChatID: record.ID, UserID: record.ID}
+			for i := range chat.Messages {
+				if chat.Messages[i].Sender == "user" {
+					chat.Messages[i].UserID = record.ID
+					membership.touch(chat.Messages[i].Timestamp)
+				}
+			}
+			db.Memberships = append(db.Memberships, membership)
+		}
+		db.Chats = append(db.Chats, chat)
+	}
+	return db
 }
 
-// SaveUserData saves user data to a JSON file
-func SaveUserData(filename string, users []UserData) error {
-	data, err := json.MarshalIndent(users, "", "  ")
+// SaveDatabase saves the user data to a JSON file
+func SaveDatabase(filename string, db *Database) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
+	data, err := json.MarshalIndent(db, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -66,20 +242,205 @@ func SaveUserData(filename string, users []UserData) error {
 	return nil
 }
 
-// AddUserMessage adds a new message to the user's conversation
-func AddUserMessage(users []UserData, userID int64, message Message) ([]UserData, error) {
-	for i, user := range users {
+// FindUser returns the user with the given ID
+func (db *Database) FindUser(userID int64) (*UserData, bool) {
+	for i := range db.Users {
+		if db.Users[i].ID == userID {
+			return &db.Users[i], true
+		}
+	}
+	return nil, false
+}
+
+// UpsertUser returns the user with the given ID, adding an empty record if the user is unknown
+func (db *Database) UpsertUser(userID int64) *UserData {
+	if user, found := db.FindUser(userID); found {
+		return user
+	}
+	db.Users = append(db.Users, UserData{ID: userID})
+	return &db.Users[len(db.Users)-1]
+}
+
+// FindChat returns the chat with the given ID
+func (db *Database) FindChat(chatID int64) (*ChatData, bool) {
+	for i := range db.Chats {
+		if db.Chats[i].ID == chatID {
+			return &db.Chats[i], true
+		}
+	}
+	return nil, false
+}
+
+// UpsertChat returns the chat with the given ID, adding an empty record if the chat is unknown
+func (db *Database) UpsertChat(chatID int64) *ChatData {
+	if chat, found := db.FindChat(chatID); found {
+		return chat
+	}
+	db.Chats = append(db.Chats, ChatData{ID: chatID})
+	return &db.Chats[len(db.Chats)-1]
+}
+
+// AddMessage appends a message to the history of a chat, counting user messages in the membership of their author
+func (db *Database) AddMessage(chatID int64, message Message) {
+	chat := db.UpsertChat(chatID)
+	chat.Messages = append(chat.Messages, message)
+	if message.UserID == 0 {
+		return
+	}
+
+	for i := range db.Memberships {
+		if db.Memberships[i].ChatID == chatID && db.Memberships[i].UserID == message.UserID {
+			db.Memberships[i].touch(message.Timestamp)
+			return
+		}
+	}
+	membership := Membership{ChatID: chatID, UserID: message.UserID}
+	membership.touch(message.Timestamp)
+	db.Memberships = append(db.Memberships, membership)
+}
+
+// touch counts a message sent at the given time
+func (m *Membership) touch(at time.Time) {
+	if m.FirstSeen.IsZero() || at.Before(m.FirstSeen) {
+		m.FirstSeen = at
+	}
+	if at.After(m.LastSeen) {
+		m.LastSeen = at
+	}
+	m.MessageCount++
+}
+
+// UserMemberships returns the memberships of a user
+func (db *Database) UserMemberships(userID int64) []Membership {
+	var memberships []Membership
+	for _, membership := range db.Memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, membership)
+		}
+	}
+	return memberships
+}
+
+// ChatMembers returns the number of users seen in a chat
+func (db *Database) ChatMembers(chatID int64) int {
+	count := 0
+	for _, membership := range db.Memberships {
+		if membership.ChatID == chatID {
+			count++
+		}
+	}
+	return count
+}
+
+// DeleteUser erases a user: their record, their memberships, their private chat, the messages they wrote in groups
+// and the bot messages about them in any chat. It reports whether anything was found.
+func (db *Database) DeleteUser(userID int64) bool {
+	found := false
+
+	users := db.Users[:0]
+	for _, user := range db.Users {
 		if user.ID == userID {
-			users[i].Messages = append(users[i].Messages, message)
-			return users, nil
+			found = true
+			continue
 		}
+		users = append(users, user)
 	}
+	db.Users = users
+
+	memberships := db.Memberships[:0]
+	for _, membership := range db.Memberships {
+		if membership.UserID == userID {
+			found = true
+			continue
+		}
+		memberships = append(memberships, membership)
+	}
+	db.Memberships = memberships
+
+	chats := db.Chats[:0]
+	for _, chat := range db.Chats {
+		if chat.ID == userID {
+			found = true
+			continue
+		}
+		// Hapus pesan pengguna di grup dan pesan bot tentang pengguna, termasuk notifikasi di chat admin.
+		// Balasan bot yang tersimpan sebelum ada about_user_id dikenali dari posisinya setelah pesan pengguna.
+		messages := chat.Messages[:0]
+		skipReply := false
+		for _, message := range chat.Messages {
+			if message.UserID == userID || message.AboutUserID == userID {
+				found, skipReply = true, message.UserID == userID
+				continue
+			}
+			if skipReply && message.Sender == "bot" && message.AboutUserID == 0 {
+				skipReply = false
+				continue
+			}
+			skipReply = false
+			messages = append(messages, message)
+		}
+		chat.Messages = messages
+		if _, inConversation := chat.MemberConversations[userID]; inConversation {
+			found = true
+			delete(chat.MemberConversations, userID)
+		}
+		chats = append(chats, chat)
+	}
+	db.Chats = chats
+
+	return found
+}
+
+// displayName returns how a user is shown in the dashboard
+func (u *UserData) displayName() string {
+	if u.Username != "" {
+		return u.Username
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// photoPath returns the admin API route serving the profile photo of the user
+func (u *UserData) photoPath() string {
+	return "/api/admin/users/" + strconv.FormatInt(u.ID, 10) + "/photo"
+}
+
+// buttonsHTML renders the inline keyboard of a bot message as badges below its text
+func buttonsHTML(buttons []Button) string {
+	if len(buttons) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<div class='mt-1'>")
+	for _, button := range buttons {
+		if button.URL != "" {
+			b.WriteString("<a href='" + html.EscapeString(button.URL) + "' class='badge badge-light mr-1' target='_blank'>" + html.EscapeString(button.Text) + "</a>")
+		} else {
+			b.WriteString("<span class='badge badge-secondary mr-1'>" + html.EscapeString(button.Text) + "</span>")
+		}
+	}
+	b.WriteString("</div>")
+	return b.String()
+}
+
+// chatPaneID returns the HTML id of the direct chat pane of a chat
+func chatPaneID(chatID int64) string {
+	return "chat-" + strconv.FormatInt(chatID, 10)
+}
 
-	return nil, os.ErrNotExist
+// displayName returns how a chat is shown in the dashboard
+func (c *ChatData) displayName(db *Database) string {
+	if c.Title != "" {
+		return c.Title
+	}
+	if user, found := db.FindUser(c.ID); found && user.displayName() != "" {
+		return user.displayName()
+	}
+	return strconv.FormatInt(c.ID, 10)
 }
 
-// SaveUserDataToHTML saves user data to an HTML file
-func SaveUserDataToHTML(users []UserData, filename string) error {
+// SaveUserDataToHTML renders the users, the chats and their conversations to an HTML dashboard
+func SaveUserDataToHTML(db *Database, filename string) error {
+	defer metrics.StorageWriteDuration.ObserveSince(time.Now(), filename)
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
@@ -163,6 +524,18 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 <p>Tables</p>
 </a>
 </li>
+<li class="nav-item">
+<a href="#search-analytics" class="nav-link">
+<i class="nav-icon fas fa-chart-bar"></i>
+<p>Search Analytics</p>
+</a>
+</li>
+<li class="nav-item">
+<a href="#broadcasts" class="nav-link">
+<i class="nav-icon fas fa-bullhorn"></i>
+<p>Broadcast</p>
+</a>
+</li>
 </ul>
 </nav>
 </div>
@@ -207,6 +580,7 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 <th>FirstName</th>
 <th>LastName</th>
 <th>PhoneNumber</th>
+<th>Chats</th>
 <th>Messages</th>
 <th>Date</th>
 </tr>
@@ -218,15 +592,17 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 	}
 
 	// Write user data to table
-	for i, user := range users {
+	for i, user := range db.Users {
 		var lastUserMessage string
 		var lastUserMessageTime time.Time
 
-		// Find the last message sent by the user
-		for _, message := range user.Messages {
-			if message.Sender == "user" {
-				lastUserMessage = message.Content
-				lastUserMessageTime = message.Timestamp
+		// Find the last message sent by the user, in any chat
+		for _, chat := range db.Chats {
+			for _, message := range chat.Messages {
+				if message.UserID == user.ID && !message.Timestamp.Before(lastUserMessageTime) {
+					lastUserMessage = message.Content
+					lastUserMessageTime = message.Timestamp
+				}
 			}
 		}
 
@@ -237,14 +613,15 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 			lastMessageTimeFormatted = "No messages"
 		}
 
+		name := html.EscapeString(user.displayName())
 		var profilePhotoHTML string
-		if user.ProfilePhotoURL != "" {
-			profilePhotoHTML = "<a href='#" + user.Username + "' class='text-white nav-link' data-toggle='tab'><img src='" + user.ProfilePhotoURL + "' alt='Profile Photo' width='50px' class='rounded-circle img-fluid'><span>" + user.Username + "</span></a>"
+		if user.ProfilePhotoFileID != "" {
+			profilePhotoHTML = "<a href='#" + chatPaneID(user.ID) + "' class='text-white nav-link' data-toggle='tab'><img src='" + html.EscapeString(user.photoPath()) + "' alt='Profile Photo' width='50px' class='rounded-circle img-fluid'><span>" + name + "</span></a>"
 		} else {
-			profilePhotoHTML = "<a href='#" + user.Username + "' class='text-white nav-link' data-toggle='tab'><span>" + user.Username + "</span></a>"
+			profilePhotoHTML = "<a href='#" + chatPaneID(user.ID) + "' class='text-white nav-link' data-toggle='tab'><span>" + name + "</span></a>"
 		}
 
-		_, err = file.WriteString("<tr> <td>" + strconv.Itoa(i+1) + "</td>  <td>" + profilePhotoHTML + "</td> <td>" + strconv.FormatInt(user.ID, 10) + "</td><td>" + user.FirstName + "</td><td>" + user.LastName + "</td><td>" + user.PhoneNumber + "</td><td>" + lastUserMessage + "</td><td>" + lastMessageTimeFormatted + "</td></tr>")
+		_, err = file.WriteString("<tr> <td>" + strconv.Itoa(i+1) + "</td>  <td>" + profilePhotoHTML + "</td> <td>" + strconv.FormatInt(user.ID, 10) + "</td><td>" + html.EscapeString(user.FirstName) + "</td><td>" + html.EscapeString(user.LastName) + "</td><td>" + html.EscapeString(user.PhoneNumber) + "</td><td>" + strconv.Itoa(len(db.UserMemberships(user.ID))) + "</td><td>" + html.EscapeString(lastUserMessage) + "</td><td>" + lastMessageTimeFormatted + "</td></tr>")
 		if err != nil {
 			return err
 		}
@@ -262,6 +639,53 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 		return err
 	}
 
+	// Chats section
+	chatTable := `
+<div class="col-12">
+<div class="card">
+<div class="card-header">
+<h3 class="card-title">DataTable Chats</h3>
+</div>
+<div class="card-body">
+<table id="example2" class="table table-bordered table-hover">
+<thead>
+<tr>
+<th>#</th>
+<th>Chat</th>
+<th>ID</th>
+<th>Type</th>
+<th>Members</th>
+<th>Messages</th>
+<th>Date</th>
+</tr>
+</thead>
+<tbody>`
+	_, err = file.WriteString(chatTable)
+	if err != nil {
+		return err
+	}
+
+	for i, chat := range db.Chats {
+		stats := chat.Stats()
+		var lastMessageTimeFormatted string
+		if !stats.LastMessageAt.IsZero() {
+			lastMessageTimeFormatted = stats.LastMessageAt.Format("2006-01-02 15:04:05")
+		} else {
+			lastMessageTimeFormatted = "No messages"
+		}
+
+		chatLink := "<a href='#" + chatPaneID(chat.ID) + "' class='text-white nav-link' data-toggle='tab'><span>" + html.EscapeString(chat.displayName(db)) + "</span></a>"
+		_, err = file.WriteString("<tr> <td>" + strconv.Itoa(i+1) + "</td>  <td>" + chatLink + "</td> <td>" + strconv.FormatInt(chat.ID, 10) + "</td><td>" + html.EscapeString(chat.Type) + "</td><td>" + strconv.Itoa(db.ChatMembers(chat.ID)) + "</td><td>" + strconv.Itoa(stats.UserMessages+stats.BotMessages+stats.AdminMessages) + "</td><td>" + lastMessageTimeFormatted + "</td></tr>")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = file.WriteString(closeTable)
+	if err != nil {
+		return err
+	}
+
 	// Direct Chat section
 	directChat := `
 <div class="col-12">
@@ -274,7 +698,7 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 </button>
 <button type="button" class="btn btn-tool" title="Contacts" data-widget="chat-pane-toggle">
 <i class="fas fa-comments"></i>
-<span class="badge badge-primary navbar-badge">3</span>
+<span class="badge badge-primary navbar-badge">` + strconv.Itoa(len(db.Chats)) + `</span>
 </button>
 </div>
 </div>
@@ -285,33 +709,43 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 		return err
 	}
 
-	// Write user messages and bot responses to direct chat
-	for _, user := range users {
-		_, err = file.WriteString("<div class='tab-pane' id='" + user.Username + "'><div class='direct-chat-messages'>")
+	// Write user messages and bot responses to direct chat, one pane per chat
+	for _, chat := range db.Chats {
+		_, err = file.WriteString("<div class='tab-pane' id='" + chatPaneID(chat.ID) + "'><div class='direct-chat-messages'>")
 		if err != nil {
 			return err
 		}
 
 		// Write each message in the conversation
-		for _, message := range user.Messages {
+		for _, message := range chat.Messages {
 			var senderName string
 			var floatClass string
 			var senderProfilePhotoURL string
 			var msgClass string
 
 			if message.Sender == "user" {
-				senderName = user.Username
+				senderName = chat.displayName(db)
+				if user, found := db.FindUser(message.UserID); found {
+					senderName = user.displayName()
+					if user.ProfilePhotoFileID != "" {
+						senderProfilePhotoURL = user.photoPath()
+					}
+				}
 				floatClass = "float-left"
-				senderProfilePhotoURL = user.ProfilePhotoURL
 				msgClass = "direct-chat-msg"
 			} else if message.Sender == "bot" {
 				senderName = "BookFinderBot"
 				floatClass = "float-right"
 				senderProfilePhotoURL = "https://media.giphy.com/media/mAgG12Pk85e1mc31HJ/giphy.gif"
 				msgClass = "direct-chat-msg right"
+			} else if message.Sender == "admin" {
+				senderName = "Admin"
+				floatClass = "float-right"
+				senderProfilePhotoURL = "https://media.giphy.com/media/mAgG12Pk85e1mc31HJ/giphy.gif"
+				msgClass = "direct-chat-msg right"
 			}
 
-			_, err = file.WriteString("<div class='" + msgClass + "'><div class='direct-chat-infos clearfix'><span class='direct-chat-name " + floatClass + "'>" + senderName + "</span><span class='direct-chat-timestamp " + floatClass + "'>" + message.Timestamp.Format("2006-01-02 15:04:05") + "</span></div><img class='direct-chat-img' src='" + senderProfilePhotoURL + "' alt='message " + message.Sender + " image'><div class='direct-chat-text'>" + message.Content + "</div></div>")
+			_, err = file.WriteString("<div class='" + msgClass + "'><div class='direct-chat-infos clearfix'><span class='direct-chat-name " + floatClass + "'>" + html.EscapeString(senderName) + "</span><span class='direct-chat-timestamp " + floatClass + "'>" + message.Timestamp.Format("2006-01-02 15:04:05") + "</span></div><img class='direct-chat-img' src='" + html.EscapeString(senderProfilePhotoURL) + "' alt='message " + message.Sender + " image'><div class='direct-chat-text'>" + html.EscapeString(message.Content) + buttonsHTML(message.Buttons) + "</div></div>")
 			if err != nil {
 				return err
 			}
@@ -334,6 +768,18 @@ func SaveUserDataToHTML(users []UserData, filename string) error {
 		return err
 	}
 
+	// Search Analytics section, filled from the /analytics/search report
+	_, err = file.WriteString(searchAnalyticsCard)
+	if err != nil {
+		return err
+	}
+
+	// Broadcast section, sending through the /broadcasts API
+	_, err = file.WriteString(broadcastCard)
+	if err != nil {
+		return err
+	}
+
 	// Footer
 	footer := `
 </div>
@@ -408,3 +854,172 @@ $('#example2').DataTable({
 
 	return nil
 }
+
+// searchAnalyticsCard is the dashboard card showing the search report. The report needs an admin session,
+// whose cookie the browser sends along with the request.
+const searchAnalyticsCard = `
+<div class="col-12" id="search-analytics">
+<div class="card">
+<div class="card-header">
+<h3 class="card-title">Search Analytics</h3>
+<div class="card-tools form-inline">
+<input type="date" id="report-from" class="form-control form-control-sm mr-1">
+<input type="date" id="report-to" class="form-control form-control-sm mr-1">
+<button type="button" id="report-load" class="btn btn-sm btn-primary">Load</button>
+</div>
+</div>
+<div class="card-body">
+<p id="report-summary">Loading...</p>
+<div class="row">
+<div class="col-md-6">
+<h5>Top Queries</h5>
+<table class="table table-sm table-striped">
+<thead><tr><th>Query</th><th>Searches</th><th>Clicks</th><th>Conversion</th></tr></thead>
+<tbody id="report-top"></tbody>
+</table>
+</div>
+<div class="col-md-6">
+<h5>Top Zero-Result Queries</h5>
+<table class="table table-sm table-striped">
+<thead><tr><th>Query</th><th>Searches</th></tr></thead>
+<tbody id="report-zero"></tbody>
+</table>
+</div>
+</div>
+</div>
+</div>
+</div>
+<script>
+function loadSearchReport() {
+  var query = new URLSearchParams();
+  if (document.getElementById("report-from").value) { query.set("from", document.getElementById("report-from").value); }
+  if (document.getElementById("report-to").value) { query.set("to", document.getElementById("report-to").value); }
+  var percent = function (value) { return (value * 100).toFixed(1) + "%"; };
+  var cell = function (value) { var td = document.createElement("td"); td.textContent = value; return td; };
+  var fill = function (id, rows, columns) {
+    var body = document.getElementById(id);
+    body.innerHTML = "";
+    rows.forEach(function (row) {
+      var tr = document.createElement("tr");
+      columns(row).forEach(function (value) { tr.appendChild(cell(value)); });
+      body.appendChild(tr);
+    });
+  };
+  fetch("/analytics/search?" + query.toString()).then(function (response) {
+    return response.json().then(function (report) {
+      if (!response.ok) { throw new Error(report.error); }
+      return report;
+    });
+  }).then(function (report) {
+    document.getElementById("report-summary").textContent = report.searches + " searches, " + report.zero_result_searches + " without results, " + report.converted_searches + " led to a click (" + percent(report.conversion) + ")";
+    fill("report-top", report.top_queries, function (row) { return [row.query, row.searches, row.clicks, percent(row.conversion)]; });
+    fill("report-zero", report.top_zero_result_queries, function (row) { return [row.query, row.searches]; });
+  }).catch(function (error) {
+    document.getElementById("report-summary").textContent = "Search report unavailable: " + error.message;
+  });
+}
+document.getElementById("report-load").addEventListener("click", loadSearchReport);
+loadSearchReport();
+</script>`
+
+// broadcastCard is the dashboard form to preview and send a broadcast, with the list of the latest broadcasts.
+// Like the search analytics card, it authenticates with the session cookie of the dashboard.
+const broadcastCard = `
+<div class="col-12" id="broadcasts">
+<div class="card">
+<div class="card-header">
+<h3 class="card-title">Broadcast</h3>
+</div>
+<div class="card-body">
+<div class="form-group">
+<textarea id="broadcast-text" class="form-control" rows="4" placeholder="Message"></textarea>
+</div>
+<div class="form-inline mb-2">
+<select id="broadcast-segment" class="form-control form-control-sm mr-1">
+<option value="semua">All users</option>
+<option value="aktif">Active in the last 30 days</option>
+<option value="id">Indonesian</option>
+<option value="en">English</option>
+</select>
+<button type="button" id="broadcast-preview" class="btn btn-sm btn-secondary mr-1">Preview</button>
+<button type="button" id="broadcast-send" class="btn btn-sm btn-primary" disabled>Send</button>
+</div>
+<p id="broadcast-summary"></p>
+<pre id="broadcast-rendered" class="text-light"></pre>
+<table class="table table-sm table-striped">
+<thead><tr><th>#</th><th>Status</th><th>Segment</th><th>Recipients</th><th>Delivered</th><th>Failed</th><th>Blocked</th><th>Pending</th><th></th></tr></thead>
+<tbody id="broadcast-list"></tbody>
+</table>
+</div>
+</div>
+</div>
+<script>
+function broadcastRequest(method, path, body) {
+  var options = { method: method, headers: {} };
+  if (body) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  return fetch(path, options).then(function (response) {
+    return response.json().then(function (data) {
+      if (!response.ok) { throw new Error(data.error); }
+      return data;
+    });
+  });
+}
+function broadcastForm(preview) {
+  return {
+    text: document.getElementById("broadcast-text").value,
+    segment: document.getElementById("broadcast-segment").value,
+    preview: preview
+  };
+}
+function loadBroadcasts() {
+  broadcastRequest("GET", "/broadcasts").then(function (broadcasts) {
+    var body = document.getElementById("broadcast-list");
+    body.innerHTML = "";
+    broadcasts.forEach(function (broadcast) {
+      var tr = document.createElement("tr");
+      [broadcast.id, broadcast.status, broadcast.segment, broadcast.recipients, broadcast.stats.delivered, broadcast.stats.failed, broadcast.stats.blocked, broadcast.stats.pending].forEach(function (value) {
+        var td = document.createElement("td");
+        td.textContent = value;
+        tr.appendChild(td);
+      });
+      var action = document.createElement("td");
+      if (broadcast.status === "sending") {
+        var stop = document.createElement("button");
+        stop.className = "btn btn-xs btn-danger";
+        stop.textContent = "Stop";
+        stop.addEventListener("click", function () {
+          broadcastRequest("POST", "/broadcasts/" + broadcast.id + "/cancel").then(loadBroadcasts);
+        });
+        action.appendChild(stop);
+      }
+      tr.appendChild(action);
+      body.appendChild(tr);
+    });
+  }).catch(function (error) {
+    document.getElementById("broadcast-summary").textContent = "Broadcasts unavailable: " + error.message;
+  });
+}
+document.getElementById("broadcast-preview").addEventListener("click", function () {
+  broadcastRequest("POST", "/broadcasts", broadcastForm(true)).then(function (preview) {
+    document.getElementById("broadcast-summary").textContent = preview.recipients + " recipients in segment " + preview.segment;
+    document.getElementById("broadcast-rendered").textContent = preview.text;
+    document.getElementById("broadcast-send").disabled = preview.recipients === 0;
+  }).catch(function (error) {
+    document.getElementById("broadcast-summary").textContent = "Preview failed: " + error.message;
+  });
+});
+document.getElementById("broadcast-send").addEventListener("click", function () {
+  if (!window.confirm("Send this broadcast?")) { return; }
+  document.getElementById("broadcast-send").disabled = true;
+  broadcastRequest("POST", "/broadcasts", broadcastForm(false)).then(function (broadcast) {
+    document.getElementById("broadcast-summary").textContent = "Broadcast #" + broadcast.id + " queued for " + broadcast.recipients + " recipients";
+    loadBroadcasts();
+  }).catch(function (error) {
+    document.getElementById("broadcast-summary").textContent = "Send failed: " + error.message;
+  });
+});
+loadBroadcasts();
+</script>`
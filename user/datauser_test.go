@@ -0,0 +1,98 @@
+package datauser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadDatabaseMigratesLegacyFile(t *testing.T) {
+	first := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		legacy          string
+		wantChat        ChatData
+		wantUsers       []UserData
+		wantMemberships []Membership
+	}{
+		{
+			name: "private chat",
+			legacy: `[{
+				"id": 42, "username": "budi", "first_name": "Budi", "language": "en", "preferred_store": "Gramedia",
+				"conversation": {"flow": "review", "step": "title"},
+				"archived": {"user_messages": 3, "bot_messages": 2},
+				"messages": [
+					{"content": "python", "sender": "user", "timestamp": "2024-05-01T10:00:00Z"},
+					{"content": "Hasil", "sender": "bot", "timestamp": "2024-05-01T10:00:01Z"},
+					{"content": "golang", "sender": "user", "timestamp": "2024-05-02T12:00:00Z"}
+				]
+			}]`,
+			wantChat: ChatData{
+				ID:             42,
+				Type:           ChatPrivate,
+				Language:       "en",
+				PreferredStore: "Gramedia",
+				Conversation:   &Conversation{Flow: "review", Step: "title"},
+				Archived:       MessageStats{UserMessages: 3, BotMessages: 2},
+				Messages: []Message{
+					{Content: "python", Sender: "user", UserID: 42, Timestamp: first},
+					{Content: "Hasil", Sender: "bot", Timestamp: first.Add(time.Second)},
+					{Content: "golang", Sender: "user", UserID: 42, Timestamp: last},
+				},
+			},
+			wantUsers: []UserData{{ID: 42, Username: "budi", FirstName: "Budi"}},
+			wantMemberships: []Membership{
+				{ChatID: 42, UserID: 42, FirstSeen: first, LastSeen: last, MessageCount: 2},
+			},
+		},
+		{
+			name: "group chat",
+			legacy: `[{
+				"id": -100123, "username": "penulis_pertama", "first_name": "Ani", "language": "id",
+				"archived": {"user_messages": 1},
+				"messages": [
+					{"content": "python", "sender": "user", "timestamp": "2024-05-01T10:00:00Z"}
+				]
+			}]`,
+			wantChat: ChatData{
+				ID:       -100123,
+				Type:     ChatGroup,
+				Language: "id",
+				Archived: MessageStats{UserMessages: 1},
+				Messages: []Message{
+					{Content: "python", Sender: "user", Timestamp: first},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "user_data.json")
+			if err := ioutil.WriteFile(filename, []byte(test.legacy), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := LoadDatabase(filename)
+			if err != nil {
+				t.Fatalf("LoadDatabase: %v", err)
+			}
+			if len(db.Chats) != 1 {
+				t.Fatalf("got %d chats, want 1", len(db.Chats))
+			}
+			if !reflect.DeepEqual(db.Chats[0], test.wantChat) {
+				t.Errorf("chat = %+v, want %+v", db.Chats[0], test.wantChat)
+			}
+			if !reflect.DeepEqual(db.Users, test.wantUsers) {
+				t.Errorf("users = %+v, want %+v", db.Users, test.wantUsers)
+			}
+			if !reflect.DeepEqual(db.Memberships, test.wantMemberships) {
+				t.Errorf("memberships = %+v, want %+v", db.Memberships, test.wantMemberships)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package datauser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageFilter selects messages by time and content. Zero fields select everything.
+type MessageFilter struct {
+	// From and To bound the message time, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+	// Text is searched in the message content, ignoring case
+	Text string
+	// ChatID keeps the messages of one chat
+	ChatID int64
+}
+
+// inRange reports whether t is within the time bounds of the filter
+func (f MessageFilter) inRange(t time.Time) bool {
+	if !f.From.IsZero() && t.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Match reports whether a message of the given chat is selected by the filter
+func (f MessageFilter) Match(chatID int64, message Message) bool {
+	if f.ChatID != 0 && chatID != f.ChatID {
+		return false
+	}
+	if !f.inRange(message.Timestamp) {
+		return false
+	}
+	return f.Text == "" || strings.Contains(strings.ToLower(message.Content), strings.ToLower(f.Text))
+}
+
+// ChatMessage is a message along with the chat it was sent in
+type ChatMessage struct {
+	ChatID int64 `json:"chat_id"`
+	Message
+}
+
+// UserSummary is a user with their activity across chats
+type UserSummary struct {
+	UserData
+	Language     string    `json:"language,omitempty"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	MessageCount int       `json:"message_count"`
+	Chats        []int64   `json:"chats"`
+}
+
+// UserFilter selects users by last activity and by name
+type UserFilter struct {
+	// From and To bound the time the user was last seen, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+	// Text is searched in the ID, username and name of the user, ignoring case
+	Text string
+}
+
+// Match reports whether a user is selected by the filter
+func (f UserFilter) Match(user UserSummary) bool {
+	if !(MessageFilter{From: f.From, To: f.To}).inRange(user.LastSeen) {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	for _, field := range []string{strconv.FormatInt(user.ID, 10), user.Username, user.FirstName + " " + user.LastName} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserSummaries returns the users selected by the filter, most recently seen first
+func (db *Database) UserSummaries(filter UserFilter) []UserSummary {
+	var summaries []UserSummary
+	for _, user := range db.Users {
+		summary := UserSummary{UserData: user, Chats: []int64{}}
+		if chat, found := db.FindChat(user.ID); found {
+			summary.Language = chat.Language
+		}
+		for _, membership := range db.UserMemberships(user.ID) {
+			if summary.FirstSeen.IsZero() || membership.FirstSeen.Before(summary.FirstSeen) {
+				summary.FirstSeen = membership.FirstSeen
+			}
+			if membership.LastSeen.After(summary.LastSeen) {
+				summary.LastSeen = membership.LastSeen
+			}
+			summary.MessageCount += membership.MessageCount
+			summary.Chats = append(summary.Chats, membership.ChatID)
+		}
+		if filter.Match(summary) {
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.SliceStable(summaries, func(a, b int) bool {
+		return summaries[a].LastSeen.After(summaries[b].LastSeen)
+	})
+	return summaries
+}
+
+// UserMessages returns the conversations of a user selected by the filter, newest first: their private chat
+// with the bot replies, and the messages they wrote in groups with the bot reply that follows each.
+func (db *Database) UserMessages(userID int64, filter MessageFilter) []ChatMessage {
+	var messages []ChatMessage
+	for _, chat := range db.Chats {
+		private := chat.ID == userID
+		replyTo := false
+		for _, message := range chat.Messages {
+			// Di grup, balasan bot langsung mengikuti pesan pengguna
+			selected := private || message.UserID == userID || (replyTo && message.Sender == "bot")
+			replyTo = message.UserID == userID
+			if selected && filter.Match(chat.ID, message) {
+				messages = append(messages, ChatMessage{ChatID: chat.ID, Message: message})
+			}
+		}
+	}
+	sort.SliceStable(messages, func(a, b int) bool {
+		return messages[a].Timestamp.After(messages[b].Timestamp)
+	})
+	return messages
+}
@@ -0,0 +1,176 @@
+package datauser
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetentionPolicy limits how long raw messages are kept and how many are kept for each user of a chat,
+// so a busy group member can't push the history of the others out. A zero field disables that limit.
+type RetentionPolicy struct {
+	MaxAge      time.Duration
+	MaxMessages int
+}
+
+// MessageStats aggregates messages of a conversation
+type MessageStats struct {
+	UserMessages   int       `json:"user_messages"`
+	BotMessages    int       `json:"bot_messages"`
+	AdminMessages  int       `json:"admin_messages,omitempty"`
+	FirstMessageAt time.Time `json:"first_message_at,omitempty"`
+	LastMessageAt  time.Time `json:"last_message_at,omitempty"`
+}
+
+// add counts a message in the stats
+func (s *MessageStats) add(message Message) {
+	switch message.Sender {
+	case "bot":
+		s.BotMessages++
+	case "admin":
+		s.AdminMessages++
+	default:
+		s.UserMessages++
+	}
+	if s.FirstMessageAt.IsZero() || message.Timestamp.Before(s.FirstMessageAt) {
+		s.FirstMessageAt = message.Timestamp
+	}
+	if message.Timestamp.After(s.LastMessageAt) {
+		s.LastMessageAt = message.Timestamp
+	}
+}
+
+// merge adds other stats to the stats
+func (s *MessageStats) merge(other MessageStats) {
+	s.UserMessages += other.UserMessages
+	s.BotMessages += other.BotMessages
+	s.AdminMessages += other.AdminMessages
+	if !other.FirstMessageAt.IsZero() && (s.FirstMessageAt.IsZero() || other.FirstMessageAt.Before(s.FirstMessageAt)) {
+		s.FirstMessageAt = other.FirstMessageAt
+	}
+	if other.LastMessageAt.After(s.LastMessageAt) {
+		s.LastMessageAt = other.LastMessageAt
+	}
+}
+
+// Stats returns the stats of every message of the chat, purged or not
+func (c *ChatData) Stats() MessageStats {
+	stats := c.Archived
+	for _, message := range c.Messages {
+		stats.add(message)
+	}
+	return stats
+}
+
+// messageOwner returns the user a message of the chat counts for in the message cap: the user of a private chat,
+// else the author of a user message or the user a bot message answers. Group messages of neither, like bot
+// replies stored before about_user_id, count for user 0.
+func (c *ChatData) messageOwner(message Message) int64 {
+	if c.ID > 0 {
+		return c.ID
+	}
+	if message.UserID != 0 {
+		return message.UserID
+	}
+	return message.AboutUserID
+}
+
+// Compact purges the messages the policy doesn't keep, folding them into the archived stats of each chat.
+// It returns the number of purged messages.
+func Compact(chats []ChatData, policy RetentionPolicy, now time.Time) int {
+	purged := 0
+	for i := range chats {
+		chat := &chats[i]
+		var kept []Message
+		for _, message := range chat.Messages {
+			if policy.MaxAge > 0 && now.Sub(message.Timestamp) > policy.MaxAge {
+				chat.Archived.add(message)
+				purged++
+				continue
+			}
+			kept = append(kept, message)
+		}
+		if policy.MaxMessages > 0 && len(kept) > policy.MaxMessages {
+			// Hitung dari pesan terbaru agar yang tersimpan adalah N pesan terakhir setiap pengguna
+			counts := make(map[int64]int)
+			keep := make([]bool, len(kept))
+			for j := len(kept) - 1; j >= 0; j-- {
+				owner := chat.messageOwner(kept[j])
+				counts[owner]++
+				keep[j] = counts[owner] <= policy.MaxMessages
+			}
+			var capped []Message
+			for j, message := range kept {
+				if !keep[j] {
+					chat.Archived.add(message)
+					purged++
+					continue
+				}
+				capped = append(capped, message)
+			}
+			kept = capped
+		}
+		chat.Messages = kept
+	}
+	return purged
+}
+
+// CompactFile applies the policy to the user data file and saves it if anything was purged
+func CompactFile(filename string, policy RetentionPolicy, now time.Time) (*Database, int, error) {
+	db, err := LoadDatabase(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	purged := Compact(db.Chats, policy, now)
+	if purged == 0 {
+		return db, 0, nil
+	}
+	return db, purged, SaveDatabase(filename, db)
+}
+
+// StartCompaction compacts the user data file now and then every interval in the background.
+// lock guards the file against the other writers, and after, if not nil, is called with the compacted data.
+// Calling the returned function stops the job.
+func StartCompaction(filename string, policy RetentionPolicy, interval time.Duration, lock sync.Locker, after func(db *Database)) func() {
+	stop := make(chan struct{})
+	compact := func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		db, purged, err := CompactFile(filename, policy, time.Now())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Failed to compact user data")
+			return
+		}
+		if purged > 0 {
+			logrus.WithFields(logrus.Fields{
+				"purged": purged,
+			}).Info("User data compacted")
+			if after != nil {
+				after(db)
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		compact()
+		for {
+			select {
+			case <-ticker.C:
+				compact()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
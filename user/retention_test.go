@@ -0,0 +1,153 @@
+package datauser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time {
+		return now.Add(-time.Duration(days) * 24 * time.Hour)
+	}
+	private := []Message{
+		{Content: "lama", Sender: "user", UserID: 7, Timestamp: daysAgo(100)},
+		{Content: "balasan lama", Sender: "bot", Timestamp: daysAgo(99)},
+		{Content: "admin", Sender: "admin", Timestamp: daysAgo(10)},
+		{Content: "baru", Sender: "user", UserID: 7, Timestamp: daysAgo(2)},
+		{Content: "balasan baru", Sender: "bot", Timestamp: daysAgo(1)},
+	}
+	// Anggota 8 sangat aktif, anggota 9 hanya menulis sekali di awal
+	group := []Message{
+		{Content: "halo", Sender: "user", UserID: 9, Timestamp: daysAgo(5)},
+		{Content: "balasan 9", Sender: "bot", AboutUserID: 9, Timestamp: daysAgo(5)},
+		{Content: "python", Sender: "user", UserID: 8, Timestamp: daysAgo(4)},
+		{Content: "balasan 8", Sender: "bot", AboutUserID: 8, Timestamp: daysAgo(4)},
+		{Content: "golang", Sender: "user", UserID: 8, Timestamp: daysAgo(3)},
+		{Content: "balasan 8", Sender: "bot", AboutUserID: 8, Timestamp: daysAgo(3)},
+	}
+
+	tests := []struct {
+		name         string
+		chatID       int64
+		messages     []Message
+		archived     MessageStats
+		policy       RetentionPolicy
+		wantPurged   int
+		wantKept     []Message
+		wantArchived MessageStats
+	}{
+		{
+			name:     "no limits",
+			chatID:   7,
+			messages: private,
+			policy:   RetentionPolicy{},
+			wantKept: private,
+		},
+		{
+			name:       "age",
+			chatID:     7,
+			messages:   private,
+			policy:     RetentionPolicy{MaxAge: 90 * 24 * time.Hour},
+			wantPurged: 2,
+			wantKept:   private[2:],
+			wantArchived: MessageStats{
+				UserMessages:   1,
+				BotMessages:    1,
+				FirstMessageAt: daysAgo(100),
+				LastMessageAt:  daysAgo(99),
+			},
+		},
+		{
+			name:       "count in a private chat",
+			chatID:     7,
+			messages:   private,
+			policy:     RetentionPolicy{MaxMessages: 2},
+			wantPurged: 3,
+			wantKept:   private[3:],
+			wantArchived: MessageStats{
+				UserMessages:   1,
+				BotMessages:    1,
+				AdminMessages:  1,
+				FirstMessageAt: daysAgo(100),
+				LastMessageAt:  daysAgo(10),
+			},
+		},
+		{
+			name:       "count after age",
+			chatID:     7,
+			messages:   private,
+			policy:     RetentionPolicy{MaxAge: 90 * 24 * time.Hour, MaxMessages: 1},
+			wantPurged: 4,
+			wantKept:   private[4:],
+			wantArchived: MessageStats{
+				UserMessages:   2,
+				BotMessages:    1,
+				AdminMessages:  1,
+				FirstMessageAt: daysAgo(100),
+				LastMessageAt:  daysAgo(2),
+			},
+		},
+		{
+			name:       "count per group member",
+			chatID:     -100,
+			messages:   group,
+			policy:     RetentionPolicy{MaxMessages: 2},
+			wantPurged: 2,
+			wantKept:   []Message{group[0], group[1], group[4], group[5]},
+			wantArchived: MessageStats{
+				UserMessages:   1,
+				BotMessages:    1,
+				FirstMessageAt: daysAgo(4),
+				LastMessageAt:  daysAgo(4),
+			},
+		},
+		{
+			name:     "merges with earlier archive",
+			chatID:   7,
+			messages: private,
+			archived: MessageStats{
+				UserMessages:   5,
+				BotMessages:    5,
+				FirstMessageAt: daysAgo(200),
+				LastMessageAt:  daysAgo(150),
+			},
+			policy:     RetentionPolicy{MaxAge: 90 * 24 * time.Hour},
+			wantPurged: 2,
+			wantKept:   private[2:],
+			wantArchived: MessageStats{
+				UserMessages:   6,
+				BotMessages:    6,
+				FirstMessageAt: daysAgo(200),
+				LastMessageAt:  daysAgo(99),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chats := []ChatData{{
+				ID:       test.chatID,
+				Archived: test.archived,
+				Messages: append([]Message(nil), test.messages...),
+			}}
+			before := chats[0].Stats()
+
+			purged := Compact(chats, test.policy, now)
+			if purged != test.wantPurged {
+				t.Errorf("purged = %d, want %d", purged, test.wantPurged)
+			}
+			if !reflect.DeepEqual(chats[0].Messages, test.wantKept) {
+				t.Errorf("kept = %+v, want %+v", chats[0].Messages, test.wantKept)
+			}
+			if !reflect.DeepEqual(chats[0].Archived, test.wantArchived) {
+				t.Errorf("archived = %+v, want %+v", chats[0].Archived, test.wantArchived)
+			}
+			// Statistik keseluruhan chat tidak berubah oleh pemadatan
+			if after := chats[0].Stats(); !reflect.DeepEqual(after, before) {
+				t.Errorf("stats = %+v, want %+v", after, before)
+			}
+		})
+	}
+}